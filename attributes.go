@@ -0,0 +1,199 @@
+package vugufmt
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+)
+
+// AttributeOptions control how the attributes of start tags are
+// written. The zero value leaves them exactly as they were.
+type AttributeOptions struct {
+	// Quote is the preferred quote character, '"' or '\''.
+	// Values that contain it are quoted with the other one instead.
+	// Zero keeps whatever quotes were used.
+	Quote byte
+	// Sort puts attributes in a canonical order: vugu directives
+	// (vg-if, vg-for, ..., and the :prop and @event shorthands)
+	// first, then id, then class, then the
+	// rest. Attributes keep their relative order otherwise.
+	Sort bool
+	// WrapAfter wraps tags that have more than this many
+	// attributes, one attribute per line. Zero means tags are
+	// only wrapped when they don't fit in the formatter's MaxWidth.
+	WrapAfter int
+}
+
+// UseAttributeOptions sets how start tag attributes are written.
+func UseAttributeOptions(opts AttributeOptions) func(*Formatter) {
+	return func(f *Formatter) {
+		f.Attributes = opts
+	}
+}
+
+// defaultIndent is used when Formatter.Indent isn't set.
+const defaultIndent = "    "
+
+func (f *Formatter) indent() string {
+	if f.Indent == "" {
+		return defaultIndent
+	}
+	return f.Indent
+}
+
+// writeStartTag writes a start tag or self-closing tag, rewriting
+// its attributes as configured. raw is the tag as it appeared
+// in the source, and attrs are its raw attributes.
+func (f *Formatter) writeStartTag(w *lineWriter, raw []byte, attrs []htmlx.RawAttribute) {
+	if f.Attributes == (AttributeOptions{}) {
+		w.Write(raw)
+		return
+	}
+
+	parts := f.attributeParts(attrs)
+	name := tagName(raw)
+	end := tagEnd(raw, attrs)
+
+	if !f.wrapAttributes(len(parts)) {
+		w.WriteString("<" + name)
+		for _, p := range parts {
+			w.WriteString(" " + p)
+		}
+		w.WriteString(end)
+		return
+	}
+
+	indent := w.indent()
+	var buf bytes.Buffer
+	buf.WriteString("<" + name)
+	for _, p := range parts {
+		buf.WriteString("\n" + indent + f.indent() + p)
+	}
+	buf.WriteString("\n" + indent + strings.TrimSpace(end))
+	w.Write(buf.Bytes())
+}
+
+// attributeParts formats all the attributes of a tag.
+func (f *Formatter) attributeParts(attrs []htmlx.RawAttribute) []string {
+	if f.Attributes.Sort {
+		attrs = sortAttributes(attrs)
+	}
+	parts := make([]string, len(attrs))
+	for i, a := range attrs {
+		parts[i] = f.formatAttribute(a)
+	}
+	return parts
+}
+
+// wrapAttributes decides whether a tag with count attributes
+// always gets one attribute per line.
+func (f *Formatter) wrapAttributes(count int) bool {
+	return f.Attributes.WrapAfter > 0 && count > f.Attributes.WrapAfter
+}
+
+// formatAttribute writes a single attribute, changing its quotes
+// if asked to and if that's possible.
+func (f *Formatter) formatAttribute(a htmlx.RawAttribute) string {
+	if !a.HasVal {
+		return a.Key
+	}
+
+	q := a.Quote
+	if want := f.Attributes.Quote; want != 0 {
+		other := byte('"')
+		if want == '"' {
+			other = '\''
+		}
+		switch {
+		case strings.IndexByte(a.Val, want) < 0:
+			q = want
+		case strings.IndexByte(a.Val, other) < 0:
+			q = other
+		}
+	}
+	if q == 0 {
+		return a.Key + "=" + a.Val
+	}
+	return a.Key + "=" + string(q) + a.Val + string(q)
+}
+
+// attributeRank is the position of an attribute in canonical order.
+func attributeRank(key string) int {
+	key = strings.ToLower(key)
+	switch {
+	case strings.HasPrefix(key, "vg-"), strings.HasPrefix(key, ":"), strings.HasPrefix(key, "@"):
+		return 0
+	case key == "id":
+		return 1
+	case key == "class":
+		return 2
+	}
+	return 3
+}
+
+// sortAttributes returns attrs in canonical order.
+func sortAttributes(attrs []htmlx.RawAttribute) []htmlx.RawAttribute {
+	sorted := append([]htmlx.RawAttribute(nil), attrs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return attributeRank(sorted[i].Key) < attributeRank(sorted[j].Key)
+	})
+	return sorted
+}
+
+// tagName returns the name of a raw tag as written, like
+// "MyComp" out of "<MyComp a='b'>".
+func tagName(raw []byte) string {
+	name := bytes.TrimLeft(raw, "</")
+	if i := bytes.IndexAny(name, " \n\r\t\f/>"); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+// tagEnd returns how a raw tag with the raw attributes attrs
+// is closed: ">", "/>" or " />".
+func tagEnd(raw []byte, attrs []htmlx.RawAttribute) string {
+	if !bytes.HasSuffix(raw, []byte("/>")) {
+		return ">"
+	}
+	trimmed := raw[:len(raw)-2]
+	if len(bytes.TrimRight(trimmed, " \n\r\t\f")) < len(trimmed) {
+		return " />"
+	}
+	// in <a href=b/>, the slash is part of the value too,
+	// so it needs a space to be kept apart from it.
+	if n := len(attrs); n > 0 && attrs[n-1].HasVal && attrs[n-1].Quote == 0 && strings.HasSuffix(attrs[n-1].Val, "/") {
+		return " />"
+	}
+	return "/>"
+}
+
+// lineWriter keeps track of the line that is being written,
+// so that tags can be wrapped and indented.
+type lineWriter struct {
+	w io.Writer
+	// line is everything written since the last newline.
+	line []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	if i := bytes.LastIndexByte(p, '\n'); i >= 0 {
+		lw.line = append(lw.line[:0], p[i+1:]...)
+	} else {
+		lw.line = append(lw.line, p...)
+	}
+	return lw.w.Write(p)
+}
+
+func (lw *lineWriter) WriteString(s string) (int, error) {
+	return lw.Write([]byte(s))
+}
+
+// indent is the leading whitespace of the current line.
+func (lw *lineWriter) indent() string {
+	trimmed := bytes.TrimLeft(lw.line, " \t")
+	return string(lw.line[:len(lw.line)-len(trimmed)])
+}
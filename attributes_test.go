@@ -0,0 +1,60 @@
+package vugufmt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func formatString(t *testing.T, f *Formatter, src string) string {
+	var buf bytes.Buffer
+	err := f.FormatHTML("", strings.NewReader(src), &buf)
+	assert.Nil(t, err, src)
+	return buf.String()
+}
+
+func TestAttributeQuotes(t *testing.T) {
+	// single quotes turn testdata/bad into testdata/ok.
+	bad, err := ioutil.ReadFile("./testdata/bad/root.vugu")
+	assert.NoError(t, err)
+	ok, err := ioutil.ReadFile("./testdata/ok/root.vugu")
+	assert.NoError(t, err)
+	formatter := NewFormatter(UseGoFmt(false), UseAttributeOptions(AttributeOptions{Quote: '\''}))
+	assert.Equal(t, string(ok), formatString(t, formatter, string(bad)))
+
+	formatter = NewFormatter(UseAttributeOptions(AttributeOptions{Quote: '"'}))
+	assert.Equal(t,
+		`<p a="x" b='say "hi"' c="it's" d="&amp;" e disabled=""></p>`,
+		formatString(t, formatter, `<p a='x' b='say "hi"' c="it's" d=&amp; e disabled=""></p>`))
+}
+
+func TestAttributesKeepCase(t *testing.T) {
+	formatter := NewFormatter(UseAttributeOptions(AttributeOptions{Quote: '"'}))
+	assert.Equal(t,
+		`<MyComp :DataSource="data.Source" @Click="x"/>`,
+		formatString(t, formatter, `<MyComp :DataSource='data.Source' @Click='x'/>`))
+}
+
+func TestAttributeSlashInValue(t *testing.T) {
+	// the slash is part of the value and closes the tag.
+	formatter := NewFormatter(UseAttributeOptions(AttributeOptions{Quote: '"'}))
+	assert.Equal(t, `<a href="b/" />`, formatString(t, formatter, `<a href=b/>`))
+	assert.Equal(t, `<a href=b/ />`, formatString(t, NewFormatter(UseMaxWidth(40)), `<a href=b/>`))
+}
+
+func TestAttributeSort(t *testing.T) {
+	formatter := NewFormatter(UseAttributeOptions(AttributeOptions{Sort: true}))
+	assert.Equal(t,
+		`<li vg-for='data.Items' :key='k' vg-if='x' @click='y' id='i' class='c' title='t'></li>`,
+		formatString(t, formatter, `<li title='t' class='c' vg-for='data.Items' :key='k' id='i' vg-if='x' @click='y'></li>`))
+}
+
+func TestAttributeWrap(t *testing.T) {
+	formatter := NewFormatter(UseAttributeOptions(AttributeOptions{WrapAfter: 2}))
+	assert.Equal(t,
+		"<div>\n    <input\n        id='a'\n        class='b'\n        disabled\n    />\n</div>",
+		formatString(t, formatter, "<div>\n    <input id='a'   class='b' disabled />\n</div>"))
+}
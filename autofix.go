@@ -0,0 +1,203 @@
+package vugufmt
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+)
+
+// UseAutoFix repairs broken tag structure the way browsers do,
+// rather than failing on it. Every fix is reported to the
+// formatter's Diagnostic hook.
+func UseAutoFix(f *Formatter) {
+	f.AutoFix = true
+}
+
+// voidElement reports whether an element never has contents
+// or an end tag, like <br> and <img>.
+func voidElement(a atom.Atom) bool {
+	return atom.Info(a).Void
+}
+
+// closedBy reports whether a start tag of next implicitly
+// closes an open element, like <li> closes the <li> before it.
+func closedBy(open, next atom.Atom) bool {
+	switch open {
+	case atom.P:
+		switch next {
+		case atom.Address, atom.Article, atom.Aside, atom.Blockquote, atom.Center, atom.Details,
+			atom.Dialog, atom.Dir, atom.Div, atom.Dl, atom.Fieldset, atom.Figcaption, atom.Figure,
+			atom.Footer, atom.Form, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Header,
+			atom.Hgroup, atom.Hr, atom.Listing, atom.Main, atom.Menu, atom.Nav, atom.Ol, atom.P,
+			atom.Plaintext, atom.Pre, atom.Section, atom.Summary, atom.Table, atom.Ul, atom.Xmp:
+			return true
+		}
+	case atom.Li:
+		return next == atom.Li
+	case atom.Dt, atom.Dd:
+		return next == atom.Dt || next == atom.Dd
+	case atom.Option:
+		return next == atom.Option || next == atom.Optgroup
+	case atom.Optgroup:
+		return next == atom.Optgroup
+	case atom.Thead, atom.Tbody, atom.Tfoot:
+		return next == atom.Tbody || next == atom.Tfoot
+	case atom.Tr:
+		return next == atom.Tr || next == atom.Thead || next == atom.Tbody || next == atom.Tfoot
+	case atom.Td, atom.Th:
+		switch next {
+		case atom.Td, atom.Th, atom.Tr, atom.Thead, atom.Tbody, atom.Tfoot:
+			return true
+		}
+	case atom.Rb, atom.Rt, atom.Rp:
+		switch next {
+		case atom.Rb, atom.Rt, atom.Rtc, atom.Rp:
+			return true
+		}
+	case atom.Rtc:
+		return next == atom.Rb || next == atom.Rtc
+	}
+	return false
+}
+
+// fixer copies a document, repairing its tag structure on the way.
+type fixer struct {
+	out []byte
+	// end is where the last thing that isn't whitespace ends in out.
+	// Missing end tags go there, so that they stay on the line of
+	// the contents they close.
+	end int
+	// copied is how much of the source has been copied.
+	copied int
+	// lineDropped is set if a tag on a line of its own was
+	// dropped, so that the line break after it goes too.
+	lineDropped bool
+	stack       tokenStack
+	filename    string
+	report      func(*FmtError)
+}
+
+// fixStructure inserts the end tags that src is missing, drops the
+// ones it has too many of, and turns void elements like <br> into
+// self-closing tags. report, if it isn't nil, is called with each fix.
+// Anything after a syntax error in src is left as it is, so that
+// formatting can report it.
+func fixStructure(filename string, src []byte, report func(*FmtError)) []byte {
+	x := &fixer{filename: filename, report: report}
+	izer := htmlx.NewTokenizer(bytes.NewReader(src))
+	// end tags are written the way their start tags are.
+	izer.PreserveCase(true)
+	for {
+		tokType := izer.Next()
+		if tokType == htmlx.ErrorToken {
+			tok := izer.Token()
+			if izer.Err() != io.EOF || len(izer.RawData()) > 0 {
+				// the error is reported when the fixed document
+				// is formatted, where it is.
+				return append(x.out, src[x.copied:]...)
+			}
+			for x.stack.top() != nil {
+				x.closeTop(&tok, "at the end of the file")
+			}
+			return x.out
+		}
+
+		raw := append([]byte(nil), izer.RawData()...)
+		tok := izer.Token()
+		x.copied += len(raw)
+		switch tokType {
+		case htmlx.StartTagToken:
+			for top := x.stack.top(); top != nil && closedBy(top.DataAtom, tok.DataAtom); top = x.stack.top() {
+				x.closeTop(&tok, "before <"+tok.Data+">")
+			}
+			if voidElement(tok.DataAtom) {
+				raw = selfClose(raw)
+				x.fix(&tok, "closed void element <%s>", tok.Data)
+				x.write(raw, false)
+				continue
+			}
+			x.stack.push(&tok)
+		case htmlx.EndTagToken:
+			if !x.open(tok.Data) {
+				x.fix(&tok, "dropped stray end tag </%s>", tok.Data)
+				x.dropLine()
+				continue
+			}
+			for !strings.EqualFold(x.stack.top().Data, tok.Data) {
+				x.closeTop(&tok, "before </"+tok.Data+">")
+			}
+			x.stack.pop()
+		}
+		x.write(raw, tokType == htmlx.TextToken)
+	}
+}
+
+// open reports whether an element called name is on the stack.
+func (x *fixer) open(name string) bool {
+	for _, tok := range x.stack {
+		if strings.EqualFold(tok.Data, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// write copies raw to the output. Whitespace at the end of text
+// doesn't move where missing end tags go.
+func (x *fixer) write(raw []byte, text bool) {
+	if x.lineDropped && text && raw[0] == '\n' {
+		raw = raw[1:]
+	}
+	x.lineDropped = false
+	x.out = append(x.out, raw...)
+	if !text {
+		x.end = len(x.out)
+	} else if trimmed := bytes.TrimRight(raw, " \t\n\r\f"); len(trimmed) > 0 {
+		x.end = len(x.out) - len(raw) + len(trimmed)
+	}
+}
+
+// dropLine takes out the indentation of the tag that was just dropped,
+// if it was at the start of a line.
+func (x *fixer) dropLine() {
+	i := bytes.LastIndexByte(x.out, '\n') + 1
+	if i <= x.end && x.end > 0 {
+		return
+	}
+	if len(bytes.Trim(x.out[i:], " \t")) == 0 {
+		x.out = x.out[:i]
+		x.lineDropped = true
+	}
+}
+
+// closeTop inserts an end tag for the element on top of the stack,
+// and reports it at tok. where says where that is, like "before </div>".
+func (x *fixer) closeTop(tok *htmlx.Token, where string) {
+	top := x.stack.pop()
+	end := "</" + top.Data + ">"
+	x.out = append(x.out[:x.end], append([]byte(end), x.out[x.end:]...)...)
+	x.end += len(end)
+	x.fix(tok, "inserted %s %s, to close the <%s> opened at %s", end, where, top.Data, position(top))
+}
+
+// fix reports a fix at tok.
+func (x *fixer) fix(tok *htmlx.Token, format string, args ...interface{}) {
+	if x.report == nil {
+		return
+	}
+	err := tokenError(tok, format, args...)
+	err.FileName = x.filename
+	x.report(err)
+}
+
+// selfClose turns a start tag like <br> into <br />.
+func selfClose(raw []byte) []byte {
+	raw = raw[:len(raw)-1]
+	if len(bytes.TrimRight(raw, " \t\n\r\f")) == len(raw) {
+		raw = append(raw, ' ')
+	}
+	return append(raw, "/>"...)
+}
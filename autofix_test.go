@@ -0,0 +1,64 @@
+package vugufmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoFix(t *testing.T) {
+	for _, c := range []struct{ src, want string }{
+		// void elements.
+		{"<p>a<br>b</p>", "<p>a<br />b</p>"},
+		{"<input type=text >", "<input type=text />"},
+		// implied end tags.
+		{"<ul>\n<li>a\n<li>b\n</ul>", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>"},
+		{"<p>a\n<div>b</div>", "<p>a</p>\n<div>b</div>"},
+		{"<table><tr><td>a<td>b<tr><td>c</table>", "<table><tr><td>a</td><td>b</td></tr><tr><td>c</td></tr></table>"},
+		{"<dl><dt>a<dd>b</dl>", "<dl><dt>a</dt><dd>b</dd></dl>"},
+		// missing end tags.
+		{"<div><span>a</div>", "<div><span>a</span></div>"},
+		{"<div>\n<p>a\n", "<div>\n<p>a</p></div>\n"},
+		// stray end tags.
+		{"<div>a</span></div>", "<div>a</div>"},
+		{"</p>", ""},
+		// nothing to fix.
+		{"<DIV><br/></DIV>", "<DIV><br/></DIV>"},
+		{"<script>if (a<b) {}</p></script>", "<script>if (a<b) {}</p></script>"},
+	} {
+		assert.Equal(t, c.want, string(fixStructure("", []byte(c.src), nil)), c.src)
+	}
+
+	// end tags are written the way their start tags are.
+	assert.Equal(t, "<UL><LI>a</LI></UL>", string(fixStructure("", []byte("<UL><LI>a</UL>"), nil)))
+	// the rest of a file with a syntax error is left alone.
+	assert.Equal(t, "<div><p class", string(fixStructure("", []byte("<div><p class"), nil)))
+}
+
+func TestAutoFixDiagnostics(t *testing.T) {
+	var diags []*FmtError
+	f := NewFormatter(UseAutoFix)
+	f.Diagnostic = func(d *FmtError) {
+		diags = append(diags, d)
+	}
+
+	src := "<ul>\n    <li>a\n    <li>b<br>\n</ul>\n</div>\n"
+	assert.Equal(t, "<ul>\n    <li>a</li>\n    <li>b<br /></li>\n</ul>\n", formatString(t, f, src))
+	require.Len(t, diags, 4)
+	assert.Equal(t, FmtError{Msg: "inserted </li> before <li>, to close the <li> opened at 2:5", Line: 3, Column: 5}, *diags[0])
+	assert.Equal(t, "closed void element <br>", diags[1].Msg)
+	assert.Equal(t, "inserted </li> before </ul>, to close the <li> opened at 3:5", diags[2].Msg)
+	assert.Equal(t, FmtError{Msg: "dropped stray end tag </div>", Line: 5, Column: 1}, *diags[3])
+
+	// without it, the same file is an error.
+	_, err := NewFormatter().FormatRange("", []byte(src), []LineRange{{Start: 1, End: 1}})
+	assert.NotNil(t, err)
+}
+
+func TestAutoFixVerify(t *testing.T) {
+	f := NewFormatter(UseAutoFix, UseMaxWidth(40), UseWhitespaceSensitivity(WhitespaceCSS))
+	src := "<div><p>a<p>b<ul><li>c<li>d</ul><img src=x></span>"
+	res := formatString(t, f, src)
+	assert.Nil(t, f.Verify("", []byte(src), []byte(res)), res)
+}
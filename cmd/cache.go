@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/erinpentecost/vugufmt"
+)
+
+// nonFormattingFlags don't change how a file gets formatted,
+// so they aren't part of the cache key.
+var nonFormattingFlags = map[string]bool{
+	"l":      true,
+	"w":      true,
+	"d":      true,
+	"watch":  true,
+	"poll":   true,
+	"verify": true,
+	"cache":  true,
+}
+
+// formatCache remembers the contents of files that are
+// already formatted, so they can be skipped next time.
+//
+// Entries live under <user cache dir>/vugufmt/<config>/, where
+// <config> is a hash of the vugufmt version, the gofmt version and
+// every flag that affects formatting. Changing any of those starts
+// over with an empty cache.
+type formatCache struct {
+	dir string
+}
+
+// openCache opens the cache for the current configuration.
+func openCache(fs *flag.FlagSet) (*formatCache, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(base, "vugufmt", configHash(fs))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &formatCache{dir: dir}, nil
+}
+
+// configHash hashes the versions and formatting flags in fs.
+func configHash(fs *flag.FlagSet) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "version=%s\n", vugufmt.Version)
+	fmt.Fprintf(h, "gofmt=%s\n", programVersion("gofmt"))
+	fs.VisitAll(func(f *flag.Flag) {
+		if !nonFormattingFlags[f.Name] {
+			fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value)
+		}
+	})
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// programVersion describes the build of the named program on PATH,
+// since a new version of it can format files differently. Programs
+// that Go didn't build are told apart by their size and time instead.
+func programVersion(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "none"
+	}
+	if info, err := buildinfo.ReadFile(path); err == nil {
+		return fmt.Sprintf("%s %s@%s", info.GoVersion, info.Path, info.Main.Version)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return path
+	}
+	return fmt.Sprintf("%s %d %s", path, fi.Size(), fi.ModTime())
+}
+
+// path returns where the entry for src is kept.
+func (c *formatCache) path(src []byte) string {
+	sum := sha256.Sum256(src)
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// formatted reports whether src is known to be formatted.
+func (c *formatCache) formatted(src []byte) bool {
+	_, err := os.Stat(c.path(src))
+	return err == nil
+}
+
+// markFormatted records that src is formatted.
+// The cache is only an optimization, so failing
+// to write to it isn't an error.
+func (c *formatCache) markFormatted(src []byte) {
+	p := c.path(src)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return
+	}
+	ioutil.WriteFile(p, nil, 0644)
+}
@@ -0,0 +1,294 @@
+// Package cmd implements the vugufmt command line tool.
+//
+// It is its own package so that other tools can embed vugufmt
+// without running it as a separate process, and so that the
+// command line can be tested end to end.
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erinpentecost/vugufmt"
+	"github.com/erinpentecost/vugufmt/lsp"
+)
+
+// Exit codes returned by Run.
+const (
+	// ExitOK means everything went fine.
+	ExitOK = 0
+	// ExitUnformatted means check found files that need formatting.
+	ExitUnformatted = 1
+	// ExitError means something went wrong, like a syntax error.
+	ExitError = 2
+)
+
+// subcommand is one of the things vugufmt can do.
+type subcommand struct {
+	name    string
+	usage   string
+	summary string
+	// flags registers the subcommand's flags.
+	flags func(r *runner, fs *flag.FlagSet)
+	run   func(ctx context.Context, r *runner, args []string)
+}
+
+var subcommands = []*subcommand{
+	{
+		name:    "fmt",
+		usage:   "fmt [flags] [path ...]",
+		summary: "format files, or standard input if no paths are given",
+		flags: func(r *runner, fs *flag.FlagSet) {
+			r.formatFlags(fs)
+			r.outputFlags(fs)
+			fs.BoolVar(&r.watch, "watch", false, "keep running and rewrite .vugu files as they change, or only report them with -l or -d")
+			fs.DurationVar(&r.poll, "poll", 500*time.Millisecond, "how often -watch checks for changes")
+		},
+		run: runFmt,
+	},
+	{
+		name:    "check",
+		usage:   "check [flags] [path ...]",
+		summary: "list files that aren't formatted and exit with status 1 if there are any",
+		flags: func(r *runner, fs *flag.FlagSet) {
+			r.formatFlags(fs)
+			fs.BoolVar(&r.useCache, "cache", false, "skip files that an earlier run found to be formatted")
+		},
+		run: func(ctx context.Context, r *runner, args []string) {
+			r.list = true
+			runFiles(ctx, r, args)
+			if r.exitCode == ExitOK && r.unformatted {
+				r.exitCode = ExitUnformatted
+			}
+		},
+	},
+	{
+		name:    "diff",
+		usage:   "diff [flags] [path ...]",
+		summary: "display diffs instead of rewriting files",
+		flags: func(r *runner, fs *flag.FlagSet) {
+			r.formatFlags(fs)
+			fs.BoolVar(&r.useCache, "cache", false, "skip files that an earlier run found to be formatted")
+		},
+		run: func(ctx context.Context, r *runner, args []string) {
+			r.doDiff = true
+			runFiles(ctx, r, args)
+		},
+	},
+	{
+		name:    "lsp",
+		usage:   "lsp [flags]",
+		summary: "run a language server on standard input and output",
+		flags: func(r *runner, fs *flag.FlagSet) {
+			r.formatFlags(fs)
+		},
+		run: func(ctx context.Context, r *runner, args []string) {
+			if len(args) != 0 {
+				r.report(fmt.Errorf("lsp doesn't take any arguments"))
+				return
+			}
+			if err := lsp.NewServer(r.newFormatter()).Serve(ctx, r.stdin, r.stdout); err != nil && err != ctx.Err() {
+				r.report(err)
+			}
+		},
+	},
+	{
+		name:    "version",
+		usage:   "version",
+		summary: "print the vugufmt version",
+		run: func(ctx context.Context, r *runner, args []string) {
+			fmt.Fprintf(r.stdout, "vugufmt %s\n", vugufmt.Version)
+		},
+	},
+	{
+		name:    "config",
+		usage:   "config [flags]",
+		summary: "print the formatting configuration the flags result in",
+		flags: func(r *runner, fs *flag.FlagSet) {
+			r.formatFlags(fs)
+		},
+		run: func(ctx context.Context, r *runner, args []string) {
+			var names []string
+			values := make(map[string]string)
+			r.flags.VisitAll(func(f *flag.Flag) {
+				names = append(names, f.Name)
+				values[f.Name] = f.Value.String()
+			})
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(r.stdout, "%s=%s\n", name, values[name])
+			}
+			fmt.Fprintf(r.stdout, "version=%s\n", vugufmt.Version)
+			fmt.Fprintf(r.stdout, "confighash=%s\n", configHash(r.flags))
+		},
+	},
+}
+
+// runner holds the state of a single Run.
+type runner struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	flags          *flag.FlagSet
+	exitCode       int
+	// unformatted is set once a file that needs formatting was found.
+	unformatted bool
+
+	simplifyAST bool
+	js          bool
+	lines       lineRanges
+	quote       quoteStyle
+	sortAttrs   bool
+	wrapAttrs   int
+	width       int
+	whitespace  whitespaceFlag
+	reflow      bool
+	eol         eolFlag
+	stripBOM    bool
+	encoding    string
+	autoFix     bool
+	verify      bool
+	list        bool
+	write       bool
+	doDiff      bool
+	watch       bool
+	poll        time.Duration
+	useCache    bool
+	cache       *formatCache
+}
+
+// formatFlags registers the flags that change how files are formatted.
+func (r *runner) formatFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&r.simplifyAST, "s", false, "simplify code")
+	fs.BoolVar(&r.js, "js", false, "format JavaScript script blocks too")
+	fs.Var(&r.lines, "lines", "only format the given line ranges, like 10:40,52:60")
+	fs.Var(&r.quote, "quote", "quote attribute values with \"double\" or 'single' quotes")
+	fs.BoolVar(&r.sortAttrs, "sortattrs", false, "put vugu directives, :prop and @event attributes, id and class first")
+	fs.IntVar(&r.wrapAttrs, "wrapattrs", 0, "put attributes on their own lines if a tag has more than this many")
+	fs.IntVar(&r.width, "width", 0, "lay out elements to fit in this many columns")
+	fs.Var(&r.whitespace, "whitespace", "which whitespace -width can change: strict, css or ignore")
+	fs.BoolVar(&r.reflow, "reflow", false, "wrap text and comments to fit in -width")
+	fs.Var(&r.eol, "eol", "line endings: auto keeps the ones most lines have, or lf or crlf")
+	fs.BoolVar(&r.stripBOM, "stripbom", false, "remove the UTF-8 byte order mark instead of keeping it")
+	fs.StringVar(&r.encoding, "encoding", "", "write files in this encoding, like utf-8, instead of the one they are in")
+	fs.BoolVar(&r.autoFix, "fix", false, "repair missing and stray end tags the way browsers do, and report each fix")
+}
+
+// outputFlags registers the flags of the plain fmt subcommand.
+func (r *runner) outputFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&r.list, "l", false, "list files whose formatting differs from vugufmt's")
+	fs.BoolVar(&r.write, "w", false, "write result to (source) file instead of stdout")
+	fs.BoolVar(&r.doDiff, "d", false, "display diffs instead of rewriting files")
+	fs.BoolVar(&r.useCache, "cache", false, "skip files that an earlier run found to be formatted")
+	fs.BoolVar(&r.verify, "verify", false, "check that formatting is idempotent and only changes whitespace before using the result")
+}
+
+// Run runs vugufmt with the given arguments, not including the
+// program name, and returns the exit status.
+//
+// The first argument picks the subcommand. If it isn't one,
+// Run behaves like "vugufmt fmt", which takes the same flags as
+// gofmt does.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	r := &runner{
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	sub := subcommands[0]
+	if len(args) > 0 {
+		if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+			usage(stdout)
+			return ExitOK
+		}
+		for _, s := range subcommands {
+			if s.name == args[0] {
+				sub = s
+				args = args[1:]
+				break
+			}
+		}
+	}
+
+	r.flags = flag.NewFlagSet("vugufmt "+sub.name, flag.ContinueOnError)
+	r.flags.SetOutput(stderr)
+	r.flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: vugufmt %s\n", sub.usage)
+		r.flags.PrintDefaults()
+	}
+	if sub.flags != nil {
+		sub.flags(r, r.flags)
+	}
+	if err := r.flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return ExitOK
+		}
+		return ExitError
+	}
+	if r.reflow && r.width == 0 {
+		r.report(fmt.Errorf("-reflow needs -width"))
+		return r.exitCode
+	}
+	if r.autoFix && len(r.lines) > 0 {
+		// the fixes can be anywhere in the file.
+		r.report(fmt.Errorf("-fix can't be used with -lines"))
+		return r.exitCode
+	}
+
+	if r.useCache {
+		var err error
+		if r.cache, err = openCache(r.flags); err != nil {
+			fmt.Fprintf(stderr, "not using cache: %s\n", err)
+		}
+	}
+
+	sub.run(ctx, r, r.flags.Args())
+	return r.exitCode
+}
+
+// usage describes all the subcommands.
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: vugufmt <command> [flags] [arguments]\n\ncommands:\n")
+	for _, s := range subcommands {
+		fmt.Fprintf(w, "  %-8s %s\n", s.name, s.summary)
+	}
+	fmt.Fprintf(w, "\nWithout a command, vugufmt works like \"vugufmt fmt\".\n")
+	fmt.Fprintf(w, "Run \"vugufmt <command> -h\" for the flags of a command.\n")
+}
+
+// newFormatter creates a formatter configured by the flags.
+func (r *runner) newFormatter() *vugufmt.Formatter {
+	f := vugufmt.NewFormatter(
+		vugufmt.UseGoFmt(r.simplifyAST),
+		vugufmt.UseAttributeOptions(vugufmt.AttributeOptions{
+			Quote:     byte(r.quote),
+			Sort:      r.sortAttrs,
+			WrapAfter: r.wrapAttrs,
+		}),
+		vugufmt.UseMaxWidth(r.width),
+		vugufmt.UseReflow(r.reflow),
+		vugufmt.UseWhitespaceSensitivity(vugufmt.WhitespaceSensitivity(r.whitespace)),
+		vugufmt.UseLineEnding(vugufmt.LineEnding(r.eol)),
+		vugufmt.UseEncoding(r.encoding),
+	)
+	if r.js {
+		vugufmt.UseJSFmt(f)
+	}
+	f.StripBOM = r.stripBOM
+	f.AutoFix = r.autoFix
+	// problems that don't stop formatting are only warnings.
+	f.Diagnostic = func(d *vugufmt.FmtError) {
+		fmt.Fprintf(r.stderr, "%s\n", d.Error())
+	}
+	return f
+}
+
+func (r *runner) report(err error) {
+	fmt.Fprintf(r.stderr, "%s\n", strings.TrimSpace(err.Error()))
+	r.exitCode = ExitError
+}
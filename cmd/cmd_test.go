@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erinpentecost/vugufmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run runs vugufmt in-process.
+func run(args []string, stdin string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = Run(context.Background(), args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// tempTree copies the root.vugu test files into a new directory.
+func tempTree(t *testing.T) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "vugufmt")
+	require.NoError(t, err)
+	for _, name := range []string{"ok", "bad"} {
+		src, err := ioutil.ReadFile(filepath.Join("..", "testdata", name, "root.vugu"))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".vugu"), src, 0644))
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func readTestdata(t *testing.T, name string) string {
+	src, err := ioutil.ReadFile(filepath.Join("..", "testdata", name, "root.vugu"))
+	require.NoError(t, err)
+	return string(src)
+}
+
+func TestVersion(t *testing.T) {
+	code, out, _ := run([]string{"version"}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "vugufmt "+vugufmt.Version+"\n", out)
+}
+
+func TestHelp(t *testing.T) {
+	code, out, _ := run([]string{"help"}, "")
+	assert.Equal(t, ExitOK, code)
+	for _, s := range subcommands {
+		assert.Contains(t, out, s.name)
+	}
+
+	code, _, errOut := run([]string{"check", "-nope"}, "")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, errOut, "usage: vugufmt check")
+}
+
+func TestFmtStdin(t *testing.T) {
+	code, out, _ := run([]string{"fmt"}, readTestdata(t, "bad"))
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, readTestdata(t, "ok")[strings.Index(readTestdata(t, "ok"), "import"):], out[strings.Index(out, "import"):])
+
+	// the old gofmt style invocation still works.
+	code, legacy, _ := run(nil, readTestdata(t, "bad"))
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, out, legacy)
+}
+
+func TestFmtJS(t *testing.T) {
+	src := "<script>\nlet a=[1,2]\n</script>\n"
+	code, out, _ := run([]string{"fmt"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, src, out)
+
+	code, out, _ = run([]string{"fmt", "-js"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<script>\nlet a = [1, 2];\n</script>\n", out)
+}
+
+func TestFmtWrite(t *testing.T) {
+	dir, cleanup := tempTree(t)
+	defer cleanup()
+
+	code, out, errOut := run([]string{"fmt", "-w", dir + "/..."}, "")
+	assert.Equal(t, ExitOK, code, errOut)
+	assert.Empty(t, out)
+
+	code, out, _ = run([]string{"-l", dir}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Empty(t, out)
+}
+
+func TestCheck(t *testing.T) {
+	dir, cleanup := tempTree(t)
+	defer cleanup()
+
+	code, out, _ := run([]string{"check", dir}, "")
+	assert.Equal(t, ExitUnformatted, code)
+	assert.Equal(t, filepath.Join(dir, "bad.vugu")+"\n", out)
+
+	code, out, _ = run([]string{"check", filepath.Join(dir, "ok.vugu")}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Empty(t, out)
+
+	code, _, errOut := run([]string{"check", filepath.Join(dir, "missing.vugu")}, "")
+	assert.Equal(t, ExitError, code)
+	assert.NotEmpty(t, errOut)
+}
+
+func TestDiff(t *testing.T) {
+	dir, cleanup := tempTree(t)
+	defer cleanup()
+
+	code, out, _ := run([]string{"diff", dir}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, out, "diff -u "+filepath.ToSlash(filepath.Join(dir, "bad.vugu")))
+	assert.Contains(t, out, "+\tisLoading bool")
+
+	// lines outside the x-go block don't change anything.
+	code, out, _ = run([]string{"diff", "-lines", "1:3", dir}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Empty(t, out)
+}
+
+func TestConfig(t *testing.T) {
+	code, out, _ := run([]string{"config", "-s"}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, out, "s=true\n")
+	assert.Contains(t, out, "version="+vugufmt.Version+"\n")
+
+	_, other, _ := run([]string{"config"}, "")
+	assert.NotEqual(t, out, other)
+}
+
+func TestCache(t *testing.T) {
+	dir, cleanup := tempTree(t)
+	defer cleanup()
+
+	old := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", old)
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	ok := filepath.Join(dir, "ok.vugu")
+	code, _, _ := run([]string{"check", "-cache", ok}, "")
+	assert.Equal(t, ExitOK, code)
+
+	matches, err := filepath.Glob(filepath.Join(dir, "cache", "vugufmt", "*", "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	// a cached result is still right on the second run.
+	code, out, _ := run([]string{"check", "-cache", ok}, "")
+	assert.Equal(t, ExitOK, code)
+	assert.Empty(t, out)
+
+	// a different configuration doesn't use it.
+	code, _, _ = run([]string{"check", "-cache", "-s", ok}, "")
+	assert.Equal(t, ExitOK, code)
+	dirs, err := filepath.Glob(filepath.Join(dir, "cache", "vugufmt", "*"))
+	require.NoError(t, err)
+	assert.Len(t, dirs, 2)
+
+	// and neither does a different gofmt.
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	before := configHash(fs)
+	bin := filepath.Join(dir, "bin")
+	require.NoError(t, os.Mkdir(bin, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(bin, "gofmt"), []byte("#!/bin/sh\ncat\n"), 0755))
+	oldPath := os.Getenv("PATH")
+	defer os.Setenv("PATH", oldPath)
+	os.Setenv("PATH", bin)
+	assert.NotEqual(t, before, configHash(fs))
+}
+
+func TestWatch(t *testing.T) {
+	dir, cleanup := tempTree(t)
+	defer cleanup()
+	bad := filepath.Join(dir, "bad.vugu")
+	ok := filepath.Join(dir, "ok.vugu")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	var out, errOut bytes.Buffer
+	go func() {
+		done <- Run(ctx, []string{"fmt", "-watch", "-poll", "10ms", dir}, nil, &out, &errOut)
+	}()
+
+	// files that were already there are left alone.
+	time.Sleep(100 * time.Millisecond)
+	src, err := ioutil.ReadFile(bad)
+	require.NoError(t, err)
+	assert.Equal(t, readTestdata(t, "bad"), string(src))
+
+	// saving a file reformats it.
+	require.NoError(t, ioutil.WriteFile(ok, []byte(readTestdata(t, "bad")), 0644))
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		// the file can be read in the middle of being written.
+		if src, _ = ioutil.ReadFile(ok); strings.Contains(string(src), "\tisLoading bool") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	assert.Equal(t, ExitOK, <-done, errOut.String())
+	assert.Contains(t, string(src), "\tisLoading bool")
+}
+
+func TestAttributeFlags(t *testing.T) {
+	code, out, _ := run([]string{"fmt", "-quote", "double", "-sortattrs"}, "<div class='a' vg-if='b'></div>")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, `<div vg-if="b" class="a"></div>`, out)
+
+	code, _, errOut := run([]string{"fmt", "-quote", "backtick"}, "")
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, errOut, "quote must be")
+}
+
+func TestLayoutFlags(t *testing.T) {
+	src := "<div><p>Some text</p><p>more</p></div>"
+	code, out, _ := run([]string{"fmt", "-width", "20"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, src, out)
+
+	code, out, _ = run([]string{"fmt", "-width", "20", "-whitespace", "css"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<div>\n    <p>Some text</p>\n    <p>more</p>\n</div>", out)
+
+	code, _, _ = run([]string{"fmt", "-whitespace", "loose"}, src)
+	assert.Equal(t, ExitError, code)
+
+	text := "<p>one two three four five six</p>"
+	code, out, _ = run([]string{"fmt", "-width", "20", "-reflow"}, text)
+	assert.Equal(t, ExitOK, code)
+	assert.NotEqual(t, text, out)
+
+	// without -width, there's nothing to reflow to.
+	code, _, errOut := run([]string{"check", "-reflow"}, text)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, errOut, "-reflow needs -width")
+}
+
+func TestVerifyFlag(t *testing.T) {
+	src := "<div><p>Some text</p><p>more</p></div>"
+	code, out, _ := run([]string{"fmt", "-verify", "-width", "20", "-whitespace", "css"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<div>\n    <p>Some text</p>\n    <p>more</p>\n</div>", out)
+
+	code, _, stderr := run([]string{"fmt", "-verify", "-lines", "1:1"}, src)
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "-lines")
+}
+
+func TestFixLinesFlags(t *testing.T) {
+	for _, sub := range []string{"fmt", "diff"} {
+		code, _, stderr := run([]string{sub, "-fix", "-lines", "1:1"}, "<div><p>a</div>")
+		assert.Equal(t, ExitError, code)
+		assert.Contains(t, stderr, "-fix can't be used with -lines")
+	}
+}
+
+func TestLineEndingFlags(t *testing.T) {
+	code, out, _ := run([]string{"fmt", "-eol", "crlf"}, "<div>\n</div>\n")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<div>\r\n</div>\r\n", out)
+
+	code, out, stderr := run([]string{"fmt", "-stripbom"}, "\xef\xbb\xbf<div>\r\n</div>\n")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<div>\r\n</div>\r\n", out)
+	assert.Contains(t, stderr, "mixed line endings")
+
+	code, _, _ = run([]string{"fmt", "-eol", "cr"}, "")
+	assert.Equal(t, ExitError, code)
+}
+
+func TestEncodingFlag(t *testing.T) {
+	src := "<meta charset=\"windows-1252\" />\n<p>R\xe9sum\xe9</p>\n"
+	code, out, _ := run([]string{"fmt"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, src, out)
+
+	code, out, _ = run([]string{"fmt", "-encoding", "utf-8"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<meta charset=\"utf-8\" />\n<p>Résumé</p>\n", out)
+}
+
+func TestFixFlag(t *testing.T) {
+	src := "<ul>\n<li>a\n<li>b<br>\n</ul>\n"
+	code, _, _ := run([]string{"fmt"}, src)
+	assert.Equal(t, ExitError, code)
+
+	code, out, stderr := run([]string{"fmt", "-fix"}, src)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "<ul>\n<li>a</li>\n<li>b<br /></li>\n</ul>\n", out)
+	assert.Contains(t, stderr, "<standard input>:3:1: inserted </li> before <li>")
+	assert.Contains(t, stderr, "closed void element <br>")
+}
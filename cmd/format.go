@@ -0,0 +1,354 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file is a modification of https://golang.org/src/cmd/gofmt/gofmt.go
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt"
+)
+
+// lineRanges collects the -lines flag.
+type lineRanges []vugufmt.LineRange
+
+func (l *lineRanges) String() string {
+	parts := make([]string, len(*l))
+	for i, r := range *l {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *lineRanges) Set(s string) error {
+	ranges, err := vugufmt.ParseLineRanges(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, ranges...)
+	return nil
+}
+
+// quoteStyle is the -quote flag.
+type quoteStyle byte
+
+func (q *quoteStyle) String() string {
+	switch *q {
+	case '"':
+		return "double"
+	case '\'':
+		return "single"
+	}
+	return ""
+}
+
+func (q *quoteStyle) Set(s string) error {
+	switch s {
+	case "double":
+		*q = '"'
+	case "single":
+		*q = '\''
+	case "":
+		*q = 0
+	default:
+		return fmt.Errorf("quote must be double or single, not %q", s)
+	}
+	return nil
+}
+
+// whitespaceFlag is the -whitespace flag.
+type whitespaceFlag vugufmt.WhitespaceSensitivity
+
+func (w *whitespaceFlag) String() string {
+	return vugufmt.WhitespaceSensitivity(*w).String()
+}
+
+func (w *whitespaceFlag) Set(s string) error {
+	ws, err := vugufmt.ParseWhitespaceSensitivity(s)
+	*w = whitespaceFlag(ws)
+	return err
+}
+
+// eolFlag is the -eol flag.
+type eolFlag vugufmt.LineEnding
+
+func (e *eolFlag) String() string {
+	return vugufmt.LineEnding(*e).String()
+}
+
+func (e *eolFlag) Set(s string) error {
+	eol, err := vugufmt.ParseLineEnding(s)
+	*e = eolFlag(eol)
+	return err
+}
+
+// runFmt runs the fmt subcommand.
+func runFmt(ctx context.Context, r *runner, args []string) {
+	if r.verify && len(r.lines) > 0 {
+		r.report(fmt.Errorf("-verify can't be used with -lines"))
+		return
+	}
+	if !r.watch {
+		runFiles(ctx, r, args)
+		return
+	}
+
+	paths := make([]string, len(args))
+	for i := range paths {
+		paths[i] = trimEllipsis(args[i])
+	}
+	if len(paths) == 0 {
+		r.report(fmt.Errorf("-watch needs at least one path"))
+		return
+	}
+	if !r.list && !r.doDiff {
+		r.write = true
+	}
+	newWatcher(paths, r.poll).run(ctx, func(path string) bool {
+		return r.watchFile(ctx, path)
+	})
+}
+
+// watchFile formats a file that -watch noticed had changed. It reports
+// false if the file changed again while it was being formatted, so
+// that it is picked up again once it settles down.
+func (r *runner) watchFile(ctx context.Context, path string) bool {
+	err := r.processFile(ctx, path, nil, r.stdout)
+	if _, ok := err.(errChanged); ok {
+		return false
+	}
+	if err != nil && !os.IsNotExist(err) {
+		r.report(err)
+	}
+	return true
+}
+
+// runFiles handles every file in args, or standard input
+// if there aren't any.
+func runFiles(ctx context.Context, r *runner, args []string) {
+	// If no file paths given, we are reading from stdin.
+	if len(args) == 0 {
+		if err := r.processFile(ctx, "<standard input>", r.stdin, r.stdout); err != nil {
+			r.report(err)
+		}
+		return
+	}
+
+	// Otherwise, we need to read a bunch of files
+	for _, path := range args {
+		path = trimEllipsis(path)
+		switch dir, err := os.Stat(path); {
+		case err != nil:
+			r.report(err)
+		case dir.IsDir():
+			r.walkDir(ctx, path)
+		default:
+			if err := r.processFile(ctx, path, nil, r.stdout); err != nil {
+				r.report(err)
+			}
+		}
+	}
+}
+
+// trimEllipsis turns a "./..." style pattern into the
+// directory it starts from. Directories are always walked
+// recursively.
+func trimEllipsis(path string) string {
+	if path == "..." {
+		return "."
+	}
+	if strings.HasSuffix(path, "/...") {
+		return strings.TrimSuffix(path, "/...")
+	}
+	return path
+}
+
+func (r *runner) walkDir(ctx context.Context, path string) {
+	filepath.Walk(path, func(path string, f os.FileInfo, err error) error {
+		if err == nil && isVuguFile(f) {
+			err = r.processFile(ctx, path, nil, r.stdout)
+		}
+
+		// Don't complain if a file was deleted in the meantime (i.e.
+		// the directory changed concurrently while running gofmt).
+		if err != nil && !os.IsNotExist(err) {
+			r.report(err)
+		}
+		return nil
+	})
+}
+
+func isVuguFile(f os.FileInfo) bool {
+	// ignore non-Vugu files
+	name := f.Name()
+	return !f.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".vugu")
+}
+
+func (r *runner) processFile(ctx context.Context, filename string, in io.Reader, out io.Writer) error {
+	var perm os.FileMode = 0644
+	// open the file if needed
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		in = f
+		perm = fi.Mode().Perm()
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	// Range formatting can leave a file unformatted,
+	// so it can't use the cache.
+	cacheable := r.cache != nil && len(r.lines) == 0
+	if cacheable && r.cache.formatted(src) {
+		if !r.list && !r.doDiff && !r.write {
+			_, err = out.Write(src)
+		}
+		return err
+	}
+
+	var resBuff bytes.Buffer
+
+	formatter := r.newFormatter()
+
+	if !r.list && !r.doDiff {
+		var res []byte
+		if len(r.lines) > 0 {
+			var ferr *vugufmt.FmtError
+			if res, ferr = formatter.FormatRangeContext(ctx, filename, src, r.lines); ferr != nil {
+				return ferr
+			}
+		} else {
+			if err := formatter.FormatHTMLContext(ctx, filename, bytes.NewReader(src), &resBuff); err != nil {
+				return err
+			}
+			res = resBuff.Bytes()
+		}
+
+		if r.verify {
+			if ferr := formatter.Verify(filename, src, res); ferr != nil {
+				return ferr
+			}
+		}
+
+		if cacheable && bytes.Equal(src, res) {
+			r.cache.markFormatted(src)
+		}
+
+		if r.write {
+			if bytes.Equal(src, res) {
+				return nil
+			}
+
+			// don't clobber edits made while we were formatting.
+			if cur, err := ioutil.ReadFile(filename); err != nil {
+				return err
+			} else if !bytes.Equal(cur, src) {
+				return errChanged(filename)
+			}
+			// make a temporary backup before overwriting original
+			bakname, err := backupFile(filename+".", src, perm)
+			if err != nil {
+				return err
+			}
+			err = ioutil.WriteFile(filename, res, perm)
+			if err != nil {
+				os.Rename(bakname, filename)
+				return err
+			}
+			err = os.Remove(bakname)
+			if err != nil {
+				return err
+			}
+		} else {
+			// just write to stdout
+			_, err = out.Write(res)
+		}
+	} else {
+		var different bool
+		if len(r.lines) > 0 {
+			different, err = formatter.DiffRangeContext(ctx, filename, bytes.NewReader(src), r.lines, &resBuff)
+		} else {
+			different, err = formatter.DiffContext(ctx, filename, bytes.NewReader(src), &resBuff)
+		}
+		if err != nil {
+			return fmt.Errorf("computing diff: %s", err)
+		}
+		if cacheable && !different {
+			r.cache.markFormatted(src)
+		}
+		if different {
+			r.unformatted = true
+		}
+		if r.list {
+			if different {
+				fmt.Fprintln(out, filename)
+			}
+		} else if r.doDiff {
+			out.Write(resBuff.Bytes())
+		}
+	}
+
+	return nil
+}
+
+// errChanged is returned when a file changes on disk
+// between reading and writing it.
+type errChanged string
+
+func (e errChanged) Error() string {
+	return string(e) + ": changed while formatting, not rewriting"
+}
+
+const chmodSupported = runtime.GOOS != "windows"
+
+// backupFile writes data to a new file named filename<number> with permissions perm,
+// with <number randomly chosen such that the file name is unique. backupFile returns
+// the chosen file name.
+func backupFile(filename string, data []byte, perm os.FileMode) (string, error) {
+
+	// create backup file
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		return "", err
+	}
+
+	bakname := f.Name()
+
+	if chmodSupported {
+		err = f.Chmod(perm)
+		if err != nil {
+			f.Close()
+			os.Remove(bakname)
+			return bakname, err
+		}
+	}
+
+	// write data to backup file
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return bakname, err
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchedFile is what we last saw of a file on disk.
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+	// changed is when we first noticed the current
+	// version of the file. It is zero if the file
+	// has already been handled.
+	changed time.Time
+}
+
+// watcher polls a set of paths for .vugu files that changed.
+type watcher struct {
+	paths    []string
+	interval time.Duration
+	// debounce is how long a file has to stay the same
+	// before we touch it. Editors often save twice in a
+	// row, and we don't want to fight them.
+	debounce time.Duration
+	files    map[string]*watchedFile
+}
+
+func newWatcher(paths []string, interval time.Duration) *watcher {
+	return &watcher{
+		paths:    paths,
+		interval: interval,
+		debounce: 2 * interval,
+		files:    make(map[string]*watchedFile),
+	}
+}
+
+// run watches until ctx is done, handing settled files to process.
+// process reports whether it handled the file, or left it alone
+// because it changed again, in which case it is handed over again
+// once it settles down.
+func (w *watcher) run(ctx context.Context, process func(path string) bool) {
+	// The first scan only records what is already there.
+	w.scan(time.Time{})
+	for _, wf := range w.files {
+		wf.changed = time.Time{}
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.step(time.Now(), process)
+	}
+}
+
+// step hands the files that have settled by now to process.
+func (w *watcher) step(now time.Time, process func(path string) bool) {
+	for _, path := range w.poll(now) {
+		if !process(path) {
+			if wf, ok := w.files[path]; ok {
+				wf.changed = now
+			}
+			continue
+		}
+		// Remember what we left on disk, so our own
+		// write doesn't look like a new change.
+		if fi, err := os.Stat(path); err == nil {
+			w.files[path] = &watchedFile{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+}
+
+// poll rescans the watched paths and returns the files that
+// changed and then stayed the same for the debounce period.
+func (w *watcher) poll(now time.Time) []string {
+	w.scan(now)
+
+	var settled []string
+	for path, wf := range w.files {
+		if !wf.changed.IsZero() && now.Sub(wf.changed) >= w.debounce {
+			wf.changed = time.Time{}
+			settled = append(settled, path)
+		}
+	}
+	return settled
+}
+
+// scan updates w.files from disk.
+func (w *watcher) scan(now time.Time) {
+	seen := make(map[string]bool)
+	visit := func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !isVuguFile(fi) {
+			return nil
+		}
+		seen[path] = true
+
+		wf, ok := w.files[path]
+		if !ok {
+			w.files[path] = &watchedFile{modTime: fi.ModTime(), size: fi.Size(), changed: now}
+			return nil
+		}
+		if !wf.modTime.Equal(fi.ModTime()) || wf.size != fi.Size() {
+			// Every new save restarts the debounce timer.
+			wf.modTime = fi.ModTime()
+			wf.size = fi.Size()
+			wf.changed = now
+		}
+		return nil
+	}
+
+	for _, path := range w.paths {
+		filepath.Walk(path, visit)
+	}
+
+	// forget about deleted files
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vugufmt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.vugu")
+	require.NoError(t, ioutil.WriteFile(path, []byte("<div></div>\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+
+	w := newWatcher([]string{dir}, 10*time.Millisecond)
+	start := time.Now()
+	w.scan(start)
+	assert.Len(t, w.files, 1, "only .vugu files are watched")
+
+	// a file is only handed over once it has stayed the same for a while.
+	assert.Empty(t, w.poll(start))
+	assert.Equal(t, []string{path}, w.poll(start.Add(w.debounce)))
+	assert.Empty(t, w.poll(start.Add(2*w.debounce)))
+
+	// every save restarts the wait.
+	require.NoError(t, ioutil.WriteFile(path, []byte("<div>\n</div>\n"), 0644))
+	changed := start.Add(3 * w.debounce)
+	assert.Empty(t, w.poll(changed))
+	require.NoError(t, ioutil.WriteFile(path, []byte("<div>\n\n</div>\n"), 0644))
+	assert.Empty(t, w.poll(changed.Add(w.debounce/2)))
+	assert.Empty(t, w.poll(changed.Add(w.debounce)))
+	assert.Equal(t, []string{path}, w.poll(changed.Add(2*w.debounce)))
+
+	require.NoError(t, os.Remove(path))
+	assert.Empty(t, w.poll(changed.Add(3*w.debounce)))
+	assert.Empty(t, w.files)
+}
+
+func TestProcessFileChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vugufmt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.vugu")
+
+	r := &runner{write: true}
+
+	read := "<script type=\"application/x-go\">\nvar  x = 1\n</script>\n"
+	edited := "<script type=\"application/x-go\">\nvar  x = 2\n</script>\n"
+
+	// the file on disk isn't what was formatted, so it's left alone.
+	require.NoError(t, ioutil.WriteFile(path, []byte(edited), 0644))
+	err = r.processFile(context.Background(), path, strings.NewReader(read), ioutil.Discard)
+	assert.Equal(t, errChanged(path), err)
+	src, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, edited, string(src))
+
+	// if it's still the same, it's rewritten.
+	require.NoError(t, ioutil.WriteFile(path, []byte(read), 0644))
+	require.NoError(t, r.processFile(context.Background(), path, strings.NewReader(read), ioutil.Discard))
+	src, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "<script type=\"application/x-go\">\nvar x = 1\n</script>\n", string(src))
+}
+
+func TestWatchEditRacesWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vugufmt")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.vugu")
+
+	read := "<script type=\"application/x-go\">\nvar  x = 1\n</script>\n"
+	edited := "<script type=\"application/x-go\">\nvar  x = 2\n</script>\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(read), 0644))
+
+	var stderr strings.Builder
+	r := &runner{write: true, stdout: ioutil.Discard, stderr: &stderr}
+	w := newWatcher([]string{dir}, 10*time.Millisecond)
+	start := time.Now()
+	w.scan(start)
+
+	// the file is edited while it's being formatted, so
+	// the formatted version isn't written.
+	calls := 0
+	w.step(start.Add(w.debounce), func(path string) bool {
+		calls++
+		require.NoError(t, ioutil.WriteFile(path, []byte(edited), 0644))
+		_, changed := r.processFile(context.Background(), path, strings.NewReader(read), ioutil.Discard).(errChanged)
+		return !changed
+	})
+	require.Equal(t, 1, calls)
+	src, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, edited, string(src))
+
+	// the edit is formatted once it settles down.
+	process := func(path string) bool {
+		calls++
+		return r.watchFile(context.Background(), path)
+	}
+	w.step(start.Add(w.debounce*3/2), process)
+	assert.Equal(t, 1, calls, "the edit hasn't settled yet")
+	w.step(start.Add(w.debounce*5/2), process)
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, stderr.String())
+	src, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "<script type=\"application/x-go\">\nvar x = 2\n</script>\n", string(src))
+
+	// and our own write isn't a change.
+	w.step(start.Add(5*w.debounce), process)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,182 @@
+package vugufmt
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/htmlx/charset"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// UseEncoding writes formatted files in the named encoding, like
+// "utf-8", rather than the one they were in.
+func UseEncoding(name string) func(*Formatter) {
+	return func(f *Formatter) {
+		f.Encoding = name
+	}
+}
+
+// sourceEncoding is the encoding a file is in.
+type sourceEncoding struct {
+	enc  encoding.Encoding
+	name string
+}
+
+// isUTF8 reports whether the encoding doesn't need converting.
+func (e sourceEncoding) isUTF8() bool {
+	return e.name == "utf-8"
+}
+
+// lookupEncoding finds an encoding by any of its names. The encoding's
+// encoder fails on runes it can't encode, rather than escaping them.
+func lookupEncoding(label string) (sourceEncoding, error) {
+	enc, err := htmlindex.Get(label)
+	if err != nil {
+		return sourceEncoding{}, fmt.Errorf("unknown encoding %q", label)
+	}
+	name, _ := htmlindex.Name(enc)
+	return sourceEncoding{enc: enc, name: name}, nil
+}
+
+// decode works out which encoding src is in, from its byte order mark
+// or <meta charset>, and turns it into UTF-8. It fails if src isn't
+// valid in that encoding, so that writing it back would change it.
+func decode(src []byte) ([]byte, sourceEncoding, error) {
+	_, name, certain := charset.DetermineEncoding(src, "")
+	// without a byte order mark or a label, the guess only looks
+	// at the start of the file, and defaults to windows-1252 if
+	// that's plain ASCII.
+	if _, _, labeled := metaCharset(src); !certain && !labeled && name == "windows-1252" && utf8.Valid(src) {
+		name = "utf-8"
+	}
+	e, err := lookupEncoding(name)
+	if err != nil {
+		return nil, e, err
+	}
+	if e.isUTF8() {
+		if !utf8.Valid(src) {
+			return nil, e, fmt.Errorf("file isn't valid UTF-8")
+		}
+		return src, e, nil
+	}
+
+	text, err := e.enc.NewDecoder().Bytes(src)
+	if err == nil {
+		var back []byte
+		back, err = e.enc.NewEncoder().Bytes(text)
+		if err == nil && !bytes.Equal(back, src) {
+			err = fmt.Errorf("decoding changes it")
+		}
+	}
+	if err != nil {
+		return nil, e, fmt.Errorf("file can't be read as %s: %s", e.name, err)
+	}
+	return text, e, nil
+}
+
+// targetEncoding is the encoding that text from src is written in:
+// the formatter's Encoding, or src's encoding if that isn't set.
+func (f *Formatter) targetEncoding(src sourceEncoding) (sourceEncoding, error) {
+	if f.Encoding == "" {
+		return src, nil
+	}
+	return lookupEncoding(f.Encoding)
+}
+
+// relabel changes the <meta> that says text is in the encoding from,
+// if there is one, to say that it is in to.
+func relabel(text []byte, from, to sourceEncoding) []byte {
+	if from.name == to.name {
+		return text
+	}
+	start, end, ok := metaCharset(text)
+	if !ok {
+		return text
+	}
+	res := append([]byte(nil), text[:start]...)
+	res = append(res, to.name...)
+	return append(res, text[end:]...)
+}
+
+// metaCharset finds the label of the <meta> that says what encoding
+// text is in, like <meta charset="utf-8"> or <meta http-equiv=
+// "Content-Type" content="text/html; charset=utf-8">. Like browsers,
+// it only looks at the first 1024 bytes. The label is text[start:end].
+func metaCharset(text []byte) (start, end int, ok bool) {
+	if len(text) > 1024 {
+		text = text[:1024]
+	}
+	izer := htmlx.NewTokenizer(bytes.NewReader(text))
+	offset := 0
+	for {
+		tt := izer.Next()
+		if tt == htmlx.ErrorToken {
+			return 0, 0, false
+		}
+		tag := offset
+		raw := bytes.ToLower(izer.Raw())
+		offset += len(raw)
+		if tt != htmlx.StartTagToken && tt != htmlx.SelfClosingTagToken ||
+			!bytes.HasPrefix(raw, []byte("<meta")) || len(raw) == len("<meta") || isAttrName(raw[len("<meta")]) {
+			continue
+		}
+		for i := 0; ; {
+			j := bytes.Index(raw[i:], []byte("charset"))
+			if j < 0 {
+				break
+			}
+			i += j + len("charset")
+			k := skipSpace(raw, i)
+			if k == len(raw) || raw[k] != '=' {
+				continue
+			}
+			k = skipSpace(raw, k+1)
+			if k < len(raw) && (raw[k] == '"' || raw[k] == '\'') {
+				k++
+			}
+			e := k
+			for e < len(raw) && isAttrName(raw[e]) {
+				e++
+			}
+			if _, err := lookupEncoding(string(raw[k:e])); e > k && err == nil {
+				return tag + k, tag + e, true
+			}
+		}
+	}
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && isSpace(b[i]) {
+		i++
+	}
+	return i
+}
+
+// isAttrName reports whether c can be in an attribute name,
+// or in an unquoted charset label.
+func isAttrName(c byte) bool {
+	return !isSpace(c) && c != '"' && c != '\'' && c != ';' && c != '>' && c != '/' && c != '='
+}
+
+// encode turns formatted UTF-8 text into the encoding it's
+// written in, as targetEncoding says. The <meta> that says
+// what encoding it's in, if there is one, is changed to match.
+func (f *Formatter) encode(text []byte, src sourceEncoding) ([]byte, error) {
+	e, err := f.targetEncoding(src)
+	if err != nil {
+		return nil, err
+	}
+	text = relabel(text, src, e)
+	if e.isUTF8() {
+		return text, nil
+	}
+	res, err := e.enc.NewEncoder().Bytes(text)
+	if err != nil {
+		return nil, fmt.Errorf("formatted file can't be written as %s: %s", e.name, err)
+	}
+	return res, nil
+}
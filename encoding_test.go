@@ -0,0 +1,69 @@
+package vugufmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// windows1252 is a document with a <meta charset>, in that encoding.
+const windows1252 = "<meta charset=\"windows-1252\" />\n<p   class='r\xe9sum\xe9'>R\xe9sum\xe9 \x80</p>\n"
+
+func TestEncodingKept(t *testing.T) {
+	f := NewFormatter(UseAttributeOptions(AttributeOptions{Quote: '"'}))
+	res := formatString(t, f, windows1252)
+	assert.Equal(t, "<meta charset=\"windows-1252\" />\n<p class=\"r\xe9sum\xe9\">R\xe9sum\xe9 \x80</p>\n", res)
+	assert.Nil(t, f.Verify("", []byte(windows1252), []byte(res)))
+}
+
+func TestEncodingConverted(t *testing.T) {
+	f := NewFormatter(UseEncoding("utf-8"))
+	res := formatString(t, f, windows1252)
+	assert.Equal(t, "<meta charset=\"utf-8\" />\n<p   class='résumé'>Résumé €</p>\n", res)
+	assert.Nil(t, f.Verify("", []byte(windows1252), []byte(res)))
+
+	// UTF-8 text that doesn't fit in windows-1252 can't be converted back.
+	var buf bytes.Buffer
+	f = NewFormatter(UseEncoding("windows-1252"))
+	err := f.FormatHTML("", strings.NewReader("<p>Привет</p>"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "windows-1252")
+
+	err = NewFormatter(UseEncoding("klingon")).FormatHTML("", strings.NewReader("<p></p>"), &buf)
+	assert.NotNil(t, err)
+}
+
+func TestEncodingLabeled(t *testing.T) {
+	// plain ASCII is still windows-1252 if the meta tag says so.
+	ascii := "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=windows-1252\" />\n<p>a</p>\n"
+	f := NewFormatter(UseEncoding("utf-8"))
+	res := formatString(t, f, ascii)
+	assert.Equal(t, "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=utf-8\" />\n<p>a</p>\n", res)
+	assert.Nil(t, f.Verify("", []byte(ascii), []byte(res)))
+
+	// and so is UTF-8 that happens to be valid windows-1252.
+	src := "<meta charset=windows-1252 />\n<p>\xc3\xa9</p>\n"
+	text, enc, err := decode([]byte(src))
+	require.NoError(t, err)
+	assert.Equal(t, "windows-1252", enc.name)
+	assert.Equal(t, "<meta charset=windows-1252 />\n<p>Ã©</p>\n", string(text))
+	assert.Equal(t, src, formatString(t, NewFormatter(), src))
+}
+
+func TestEncodingLossy(t *testing.T) {
+	// the meta tag says Shift_JIS, but the bytes aren't.
+	var buf bytes.Buffer
+	err := NewFormatter().FormatHTML("", strings.NewReader("<meta charset=\"shift_jis\" />\n<p>\x82\xff</p>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "shift_jis")
+	assert.Empty(t, buf.String())
+}
+
+func TestEncodingUTF16(t *testing.T) {
+	// "<p>a</p>\n" in UTF-16LE, with a byte order mark.
+	src := "\xff\xfe<\x00p\x00>\x00a\x00<\x00/\x00p\x00>\x00\n\x00"
+	assert.Equal(t, src, formatString(t, NewFormatter(UseMaxWidth(80)), src))
+}
@@ -0,0 +1,170 @@
+package vugufmt
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// LineEnding is how the lines of a formatted file end.
+type LineEnding int
+
+const (
+	// EOLAuto keeps the line endings that most of the lines
+	// of the file already have.
+	EOLAuto LineEnding = iota
+	// EOLLF ends lines with \n.
+	EOLLF
+	// EOLCRLF ends lines with \r\n.
+	EOLCRLF
+)
+
+var lineEndingNames = []string{"auto", "lf", "crlf"}
+
+func (eol LineEnding) String() string {
+	if eol < 0 || int(eol) >= len(lineEndingNames) {
+		return fmt.Sprintf("LineEnding(%d)", int(eol))
+	}
+	return lineEndingNames[eol]
+}
+
+// ParseLineEnding parses "auto", "lf" or "crlf".
+func ParseLineEnding(s string) (LineEnding, error) {
+	for i, name := range lineEndingNames {
+		if s == name {
+			return LineEnding(i), nil
+		}
+	}
+	return EOLAuto, fmt.Errorf("line endings must be auto, lf or crlf, not %q", s)
+}
+
+// UseLineEnding sets how the lines of formatted files end.
+func UseLineEnding(eol LineEnding) func(*Formatter) {
+	return func(f *Formatter) {
+		f.LineEnding = eol
+	}
+}
+
+// UseStripBOM removes the UTF-8 byte order mark
+// from the start of files, rather than keeping it.
+func UseStripBOM(f *Formatter) {
+	f.StripBOM = true
+}
+
+var (
+	utf8BOM = []byte("\xef\xbb\xbf")
+	crlf    = []byte("\r\n")
+	lf      = []byte("\n")
+)
+
+// sourceText is a file turned into UTF-8, with its
+// line endings and byte order mark taken out.
+type sourceText struct {
+	text []byte
+	enc  sourceEncoding
+	bom  bool
+	crlf bool
+}
+
+// readSource turns src into UTF-8, takes its byte order mark out and
+// turns its line endings into \n, which is what everything else works
+// with. Mixed line endings are reported to the formatter's Diagnostic hook.
+// If the formatter has AutoFix set, its tag structure is repaired too.
+func (f *Formatter) readSource(filename string, src []byte) (sourceText, *FmtError) {
+	s, ferr := f.decodeSource(filename, src)
+	if ferr != nil {
+		return s, ferr
+	}
+	if bytes.Contains(s.text, crlf) {
+		s.text = bytes.Replace(s.text, crlf, lf, -1)
+	}
+	if f.AutoFix {
+		s.text = fixStructure(filename, s.text, f.Diagnostic)
+	}
+	return s, nil
+}
+
+// decodeSource turns src into UTF-8 and takes its byte order mark
+// out, but leaves its line endings alone. It works out which ones
+// most of its lines have, and reports mixed line endings.
+func (f *Formatter) decodeSource(filename string, src []byte) (sourceText, *FmtError) {
+	var s sourceText
+	var err error
+	if src, s.enc, err = decode(src); err != nil {
+		return s, &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	if bytes.HasPrefix(src, utf8BOM) {
+		s.bom = true
+		src = src[len(utf8BOM):]
+	}
+
+	crlfs := bytes.Count(src, crlf)
+	lfs := bytes.Count(src, lf) - crlfs
+	// lines end the way most of them already do,
+	// or the way the first one does if it's a tie.
+	s.crlf = crlfs > lfs
+	if crlfs == lfs && crlfs > 0 {
+		i := bytes.IndexByte(src, '\n')
+		s.crlf = i > 0 && src[i-1] == '\r'
+	}
+	if crlfs > 0 && lfs > 0 && f.Diagnostic != nil {
+		f.Diagnostic(&FmtError{
+			Msg:      fmt.Sprintf("mixed line endings: %d lines end with \\r\\n and %d with \\n", crlfs, lfs),
+			FileName: filename,
+			Line:     firstOddLine(src, s.crlf),
+			Column:   1,
+		})
+	}
+	s.text = src
+	return s, nil
+}
+
+// firstOddLine returns the 1-based number of the first line
+// that doesn't end with \r\n if crlf is set, or does if it isn't.
+func firstOddLine(src []byte, crlf bool) int {
+	line := 1
+	for i, c := range src {
+		if c != '\n' {
+			continue
+		}
+		if (i > 0 && src[i-1] == '\r') != crlf {
+			return line
+		}
+		line++
+	}
+	return line
+}
+
+// writeSource puts line endings and the byte order mark back into
+// formatted text, and encodes it, as the formatter's options and
+// the source say.
+func (f *Formatter) writeSource(filename string, s sourceText, res []byte) ([]byte, *FmtError) {
+	if f.useCRLF(s) {
+		res = bytes.Replace(res, lf, crlf, -1)
+	}
+	return f.encodeSource(filename, s, res)
+}
+
+// useCRLF reports whether the lines of the formatted
+// version of s end with \r\n.
+func (f *Formatter) useCRLF(s sourceText) bool {
+	switch f.LineEnding {
+	case EOLLF:
+		return false
+	case EOLCRLF:
+		return true
+	}
+	return s.crlf
+}
+
+// encodeSource puts the byte order mark back into formatted
+// text, and encodes it, but leaves its line endings alone.
+func (f *Formatter) encodeSource(filename string, s sourceText, res []byte) ([]byte, *FmtError) {
+	if s.bom && !f.StripBOM {
+		res = append(append([]byte(nil), utf8BOM...), res...)
+	}
+	res, err := f.encode(res, s.enc)
+	if err != nil {
+		return nil, &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	return res, nil
+}
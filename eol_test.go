@@ -0,0 +1,68 @@
+package vugufmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineEndingsKept(t *testing.T) {
+	src := "<div>\r\n<p>a</p>\r\n</div>\r\n\r\n<script type=\"application/x-go\">\r\nvar x   = 1\r\n</script>\r\n"
+	f := NewFormatter(UseGoFmt(false))
+	assert.Equal(t, strings.Replace(src, "x   =", "x =", 1), formatString(t, f, src))
+
+	// laying the document out doesn't mix in any \n either.
+	f = NewFormatter(UseGoFmt(false), UseMaxWidth(10))
+	res := formatString(t, f, src)
+	assert.Equal(t, strings.Count(res, "\n"), strings.Count(res, "\r\n"), res)
+}
+
+func TestLineEndingsForced(t *testing.T) {
+	src := "<div>\n<p>a</p>\n</div>\n"
+	assert.Equal(t, strings.Replace(src, "\n", "\r\n", -1), formatString(t, NewFormatter(UseLineEnding(EOLCRLF)), src))
+	assert.Equal(t, src, formatString(t, NewFormatter(UseLineEnding(EOLLF)), strings.Replace(src, "\n", "\r\n", -1)))
+
+	// ranges only change the line endings of the lines in them.
+	res, err := NewFormatter(UseLineEnding(EOLLF)).FormatRange("", []byte("<div>\r\n<p>a</p>\r\n</div>\r\n<p>b</p>\r\n"), []LineRange{{Start: 1, End: 1}})
+	require.Nil(t, err)
+	assert.Equal(t, "<div>\n<p>a</p>\n</div>\r\n<p>b</p>\r\n", string(res))
+}
+
+func TestMixedLineEndings(t *testing.T) {
+	var diags []*FmtError
+	f := NewFormatter()
+	f.Diagnostic = func(d *FmtError) {
+		diags = append(diags, d)
+	}
+
+	// most lines end with \r\n, so the one that doesn't is reported.
+	src := "<div>\r\n<p>a</p>\n<p>b</p>\r\n</div>\r\n"
+	assert.Equal(t, strings.Replace(src, "</p>\n", "</p>\r\n", 1), formatString(t, f, src))
+	require.Len(t, diags, 1)
+	assert.Equal(t, 2, diags[0].Line)
+	assert.Contains(t, diags[0].Msg, "mixed line endings")
+
+	// but lines outside a range are left as they are.
+	src = "<div>\r\n<p>a</p>\r\n</div>\r\n<p>b</p>\n"
+	res, err := f.FormatRange("", []byte(src), []LineRange{{Start: 1, End: 1}})
+	require.Nil(t, err)
+	assert.Equal(t, src, string(res))
+}
+
+func TestBOM(t *testing.T) {
+	src := "\xef\xbb\xbf<div>\n    <p>a</p>\n</div>\n"
+	assert.Equal(t, src, formatString(t, NewFormatter(UseMaxWidth(80)), src))
+	assert.Equal(t, src[3:], formatString(t, NewFormatter(UseStripBOM), src))
+}
+
+func TestParseLineEnding(t *testing.T) {
+	for _, eol := range []LineEnding{EOLAuto, EOLLF, EOLCRLF} {
+		parsed, err := ParseLineEnding(eol.String())
+		assert.NoError(t, err)
+		assert.Equal(t, eol, parsed)
+	}
+	_, err := ParseLineEnding("cr")
+	assert.Error(t, err)
+}
@@ -0,0 +1,317 @@
+package vugufmt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UseExternal formats script blocks of scriptType with a command. It is
+// run for each block, with the block on its standard input, and writes
+// the formatted block to its standard output. If it fails, an error on
+// its standard error like "file:line:column: message" is reported where
+// it is in the block, the way gofmt's are. A timeout of zero lets the
+// command take as long as it likes.
+func UseExternal(scriptType string, argv []string, timeout time.Duration) func(*Formatter) {
+	return func(f *Formatter) {
+		f.Scripts[strings.ToLower(scriptType)] = &external{argv: argv, timeout: timeout}
+	}
+}
+
+// external runs a command for each block it formats.
+type external struct {
+	argv    []string
+	timeout time.Duration
+}
+
+func (e *external) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	if len(e.argv) == 0 {
+		return ScriptResult{}, &FmtError{Msg: "no command to format " + req.Type + " blocks with"}
+	}
+	name := filepath.Base(e.argv[0])
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.argv[0], e.argv[1:]...)
+	cmd.Stdin = bytes.NewReader(req.Src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = outputWait
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// it finished, but something it started has its output open.
+		err = nil
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() == context.DeadlineExceeded:
+		return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s timed out", name)}
+	case ctx.Err() != nil:
+		return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s: %s", name, ctx.Err())}
+	case err != nil:
+		return ScriptResult{}, commandError(name, err, stderr.String())
+	}
+	return ScriptResult{Src: stdout.Bytes()}, nil
+}
+
+// commandError is the error for the command name failing with err,
+// after writing stderr. Only the first line of stderr is kept.
+func commandError(name string, err error, stderr string) *FmtError {
+	msg := strings.TrimSpace(stderr)
+	if msg == "" {
+		return &FmtError{Msg: fmt.Sprintf("%s: %s", name, err)}
+	}
+	msg = strings.SplitN(msg, "\n", 2)[0]
+	ferr := fromGoFmt(msg)
+	if ferr.Line == 0 {
+		ferr.Msg = name + ": " + msg
+	}
+	return ferr
+}
+
+// PluginRequest is a block that is sent to a plugin.
+type PluginRequest struct {
+	// ID is the request's number, which the response has too.
+	ID       int    `json:"id"`
+	Filename string `json:"filename,omitempty"`
+	Type     string `json:"type"`
+	Indent   string `json:"indent,omitempty"`
+	Src      string `json:"src"`
+}
+
+// PluginResponse is a plugin's answer to a PluginRequest.
+type PluginResponse struct {
+	ID  int    `json:"id"`
+	Src string `json:"src"`
+	// Error is set if the block couldn't be formatted.
+	Error *PluginError `json:"error,omitempty"`
+}
+
+// PluginError is a problem with a block. Line and Column
+// count from 1, from the start of the block, and are 0
+// if they aren't known.
+type PluginError struct {
+	Msg    string `json:"msg"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// outputWait is how long a command's output is read for once it has
+// exited, in case a process that it started still has it open.
+const outputWait = 200 * time.Millisecond
+
+// pluginExitWait is how long a plugin has to exit once
+// its input is closed, before it is killed.
+const pluginExitWait = 5 * time.Second
+
+// Plugin is a formatter process that formats many blocks, so that it
+// only has to be started once. Each block is sent to it as a line of
+// JSON, a PluginRequest, and it answers each one in turn with a line
+// of JSON, a PluginResponse. Its standard error goes to Stderr.
+//
+// The process is started when it's first needed, and runs until Close
+// is called. It is started again if it exits, or if it takes longer
+// than the timeout to answer.
+type Plugin struct {
+	// Stderr is where the process's standard error is written.
+	// If it is nil, it is thrown away.
+	Stderr io.Writer
+
+	argv    []string
+	timeout time.Duration
+
+	mu sync.Mutex
+	// proc is the running process, or nil.
+	proc   *pluginProc
+	lastID int
+}
+
+// pluginProc is a running plugin process.
+type pluginProc struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	// lines are the lines of the process's output.
+	lines chan []byte
+	// done is closed when the process is being stopped,
+	// and exited when it has exited, with err.
+	done, exited chan struct{}
+	err          error
+}
+
+// NewPlugin returns a Plugin that runs argv. A timeout of zero
+// lets it take as long as it likes to answer a request.
+func NewPlugin(argv []string, timeout time.Duration) *Plugin {
+	return &Plugin{argv: argv, timeout: timeout}
+}
+
+// UsePlugin formats script blocks of the types scriptTypes with p.
+func UsePlugin(p *Plugin, scriptTypes ...string) func(*Formatter) {
+	return func(f *Formatter) {
+		for _, t := range scriptTypes {
+			f.Scripts[strings.ToLower(t)] = p
+		}
+	}
+}
+
+// Format sends req to the plugin, and waits for its answer.
+func (p *Plugin) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.argv) == 0 {
+		return ScriptResult{}, &FmtError{Msg: "no plugin to format " + req.Type + " blocks with"}
+	}
+	name := filepath.Base(p.argv[0])
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	if p.proc != nil {
+		select {
+		case <-p.proc.exited:
+			// it exited after its last answer.
+			p.stop()
+		default:
+		}
+	}
+	if p.proc == nil {
+		proc, err := startPlugin(p.argv, p.Stderr)
+		if err != nil {
+			return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("can't run %s: %s", name, err)}
+		}
+		p.proc = proc
+	}
+
+	p.lastID++
+	line, err := json.Marshal(PluginRequest{
+		ID:       p.lastID,
+		Filename: req.Filename,
+		Type:     req.Type,
+		Indent:   req.Indent,
+		Src:      string(req.Src),
+	})
+	if err != nil {
+		return ScriptResult{}, err
+	}
+	if _, err := p.proc.in.Write(append(line, '\n')); err != nil {
+		p.stop()
+		return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s exited", name)}
+	}
+
+	var res PluginResponse
+	select {
+	case <-ctx.Done():
+		// the answer would be read as the next one's, so the
+		// process can't be used any more.
+		p.stop()
+		if ctx.Err() == context.DeadlineExceeded {
+			return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s timed out", name)}
+		}
+		return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s: %s", name, ctx.Err())}
+	case line, ok := <-p.proc.lines:
+		if !ok {
+			p.stop()
+			return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s exited", name)}
+		}
+		if err := json.Unmarshal(line, &res); err != nil || res.ID != p.lastID {
+			p.stop()
+			return ScriptResult{}, &FmtError{Msg: fmt.Sprintf("%s answered with %q", name, line)}
+		}
+	}
+	if res.Error != nil {
+		return ScriptResult{}, &FmtError{Msg: res.Error.Msg, Line: res.Error.Line, Column: res.Error.Column}
+	}
+	return ScriptResult{Src: []byte(res.Src)}, nil
+}
+
+// Close stops the plugin's process, if it's running. It is asked
+// to exit by closing its input, and is killed if it doesn't.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.proc == nil {
+		return nil
+	}
+	proc := p.proc
+	p.proc = nil
+	close(proc.done)
+	proc.in.Close()
+	select {
+	case <-proc.exited:
+	case <-time.After(pluginExitWait):
+		proc.cmd.Process.Kill()
+		<-proc.exited
+	}
+	return proc.err
+}
+
+// stop kills the plugin's process.
+func (p *Plugin) stop() {
+	proc := p.proc
+	p.proc = nil
+	close(proc.done)
+	proc.in.Close()
+	proc.cmd.Process.Kill()
+	<-proc.exited
+}
+
+func startPlugin(argv []string, stderr io.Writer) (*pluginProc, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Wait returns once all of the output has been read, or
+	// outputWait after the process exits if something that
+	// it started still has its output open.
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = stderr
+	cmd.WaitDelay = outputWait
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	proc := &pluginProc{
+		cmd:    cmd,
+		in:     in,
+		lines:  make(chan []byte),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	go func() {
+		proc.err = cmd.Wait()
+		if errors.Is(proc.err, exec.ErrWaitDelay) {
+			proc.err = nil
+		}
+		w.Close()
+		close(proc.exited)
+	}()
+	go func() {
+		defer close(proc.lines)
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, 64<<20)
+		for s.Scan() {
+			select {
+			case proc.lines <- append([]byte(nil), s.Bytes()...):
+			case <-proc.done:
+			}
+		}
+		io.Copy(ioutil.Discard, r)
+	}()
+	return proc, nil
+}
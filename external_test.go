@@ -0,0 +1,224 @@
+package vugufmt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// helperCommand is a command that runs the test binary as
+// TestHelperProcess, which pretends to be a formatter.
+func helperCommand(mode string) []string {
+	return []string{os.Args[0], "-test.run=TestHelperProcess", "--", mode}
+}
+
+// TestHelperProcess upper-cases blocks. A block with "bad" in it
+// is an error on its second line, and one with "slow" takes
+// too long. One with "fork" starts a process that keeps its
+// output open, and exits, and one with "spawn" does the same but
+// formats the block first. A plugin exits after answering a block
+// with "bye" in it. It is only a test when it's run by helperCommand.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("VUGUFMT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+	format := func(src string) (string, *PluginError) {
+		switch {
+		case strings.Contains(src, "bad"):
+			return "", &PluginError{Msg: "bad thing", Line: 2, Column: 3}
+		case strings.Contains(src, "slow"):
+			time.Sleep(10 * time.Second)
+		case strings.Contains(src, "crash"):
+			os.Exit(3)
+		case strings.Contains(src, "fork"):
+			sleeper()
+			os.Exit(3)
+		case strings.Contains(src, "spawn"):
+			sleeper()
+		}
+		return strings.ToUpper(src), nil
+	}
+
+	switch os.Args[len(os.Args)-1] {
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	case "external":
+		src, _ := ioutil.ReadAll(os.Stdin)
+		res, err := format(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<standard input>:%d:%d: %s\nmore detail\n", err.Line, err.Column, err.Msg)
+			os.Exit(2)
+		}
+		fmt.Print(res)
+	case "plugin":
+		s := bufio.NewScanner(os.Stdin)
+		for s.Scan() {
+			var req PluginRequest
+			if err := json.Unmarshal(s.Bytes(), &req); err != nil {
+				os.Exit(2)
+			}
+			res := PluginResponse{ID: req.ID}
+			res.Src, res.Error = format(req.Src)
+			if res.Error != nil {
+				fmt.Fprintf(os.Stderr, "%s in block %d\n", res.Error.Msg, req.ID)
+			}
+			if req.Indent != "" {
+				res.Src = req.Indent + res.Src
+			}
+			line, _ := json.Marshal(res)
+			fmt.Printf("%s\n", line)
+			if strings.Contains(req.Src, "bye") {
+				os.Exit(0)
+			}
+		}
+	}
+}
+
+// sleeper starts a process that keeps the helper's output open.
+func sleeper() {
+	cmd := exec.Command(os.Args[0], helperCommand("sleep")[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.Start()
+}
+
+// withHelper lets the commands of helperCommand run,
+// until the func it returns is called.
+func withHelper() func() {
+	os.Setenv("VUGUFMT_HELPER_PROCESS", "1")
+	return func() { os.Unsetenv("VUGUFMT_HELPER_PROCESS") }
+}
+
+func TestUseExternal(t *testing.T) {
+	defer withHelper()()
+	formatter := NewFormatter(UseExternal("text/X", helperCommand("external"), 5*time.Second))
+
+	assert.Equal(t, "<script type=\"text/x\">ONE\nTWO</script>\n", formatString(t, formatter, "<script type=\"text/x\">one\ntwo</script>\n"))
+
+	// errors are where they are in the file, and only their first line is kept.
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("x.vugu", strings.NewReader("<div>\n<script type=\"text/x\">\nbad\n</script>\n</div>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:3:3: bad thing", err.Error())
+
+	err = formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">crash</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "exit status 3")
+
+	formatter = NewFormatter(UseExternal("text/x", helperCommand("external"), 100*time.Millisecond))
+	err = formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">slow</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "timed out")
+
+	formatter = NewFormatter(UseExternal("text/x", []string{"no-such-formatter"}, 0))
+	err = formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">a</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, 1, err.Line)
+}
+
+func TestExternalForked(t *testing.T) {
+	defer withHelper()()
+	formatter := NewFormatter(UseExternal("text/x", helperCommand("external"), 5*time.Second))
+
+	// the command has finished, even though the process
+	// it started still has its output open.
+	start := time.Now()
+	assert.Equal(t, "<script type=\"text/x\">SPAWN</script>\n", formatString(t, formatter, "<script type=\"text/x\">spawn</script>\n"))
+	assert.True(t, time.Since(start) < 5*time.Second, "finished after %s", time.Since(start))
+}
+
+func TestPlugin(t *testing.T) {
+	defer withHelper()()
+	p := NewPlugin(helperCommand("plugin"), 5*time.Second)
+	defer p.Close()
+	formatter := NewFormatter(UsePlugin(p, "text/x", "text/y"))
+
+	src := "<div>\n  <script type=\"text/x\">one</script>\n  <script type=\"text/y\">two</script>\n</div>\n"
+	assert.Equal(t, "<div>\n  <script type=\"text/x\">  ONE</script>\n  <script type=\"text/y\">  TWO</script>\n</div>\n", formatString(t, formatter, src))
+	pid := p.proc.cmd.Process.Pid
+	formatString(t, formatter, src)
+	assert.Equal(t, pid, p.proc.cmd.Process.Pid, "one process serves every block")
+
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">\nbad</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:2:3: bad thing", err.Error())
+	assert.NotNil(t, p.proc, "errors in blocks don't stop the plugin")
+
+	// the plugin is started again after it crashes.
+	err = formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">crash</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "exited")
+	assert.Nil(t, p.proc)
+	assert.Equal(t, "<script type=\"text/x\">A</script>\n", formatString(t, formatter, "<script type=\"text/x\">a</script>\n"))
+
+	require.NoError(t, p.Close())
+	assert.Nil(t, p.proc)
+}
+
+func TestPluginStderr(t *testing.T) {
+	defer withHelper()()
+	var stderr bytes.Buffer
+	p := NewPlugin(helperCommand("plugin"), 5*time.Second)
+	p.Stderr = &stderr
+	formatter := NewFormatter(UsePlugin(p, "text/x"))
+
+	var buf bytes.Buffer
+	assert.NotNil(t, formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">bad</script>\n"), &buf))
+	require.NoError(t, p.Close())
+	assert.Equal(t, "bad thing in block 1\n", stderr.String())
+}
+
+func TestPluginForked(t *testing.T) {
+	defer withHelper()()
+	p := NewPlugin(helperCommand("plugin"), 5*time.Second)
+	defer p.Close()
+	formatter := NewFormatter(UsePlugin(p, "text/x"))
+
+	// the plugin has exited, even though the process it
+	// started still has its output open.
+	start := time.Now()
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">fork</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "exited")
+	assert.True(t, time.Since(start) < 5*time.Second, "exited after %s", time.Since(start))
+	assert.Equal(t, "<script type=\"text/x\">A</script>\n", formatString(t, formatter, "<script type=\"text/x\">a</script>\n"))
+}
+
+func TestPluginExits(t *testing.T) {
+	defer withHelper()()
+	p := NewPlugin(helperCommand("plugin"), 5*time.Second)
+	defer p.Close()
+	formatter := NewFormatter(UsePlugin(p, "text/x"))
+
+	// the answer of a plugin that exits straight after is kept.
+	// once it has, it is started again.
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "<script type=\"text/x\">BYE</script>\n", formatString(t, formatter, "<script type=\"text/x\">bye</script>\n"))
+		<-p.proc.exited
+	}
+}
+
+func TestPluginTimeout(t *testing.T) {
+	defer withHelper()()
+	p := NewPlugin(helperCommand("plugin"), 100*time.Millisecond)
+	defer p.Close()
+	formatter := NewFormatter(UsePlugin(p, "text/x"))
+
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("x.vugu", strings.NewReader("<script type=\"text/x\">slow</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "timed out")
+	assert.Equal(t, "<script type=\"text/x\">A</script>\n", formatString(t, formatter, "<script type=\"text/x\">a</script>\n"))
+}
@@ -6,12 +6,35 @@ import (
 	"strings"
 )
 
+// ErrorCode says what kind of problem a FmtError is, so that
+// tools can tell them apart without reading the message.
+type ErrorCode string
+
+const (
+	// CodeSyntax is HTML that can't be read, like a tag
+	// that the file ends in the middle of.
+	CodeSyntax ErrorCode = "syntax"
+	// CodeStrayEndTag is an end tag that doesn't close anything.
+	CodeStrayEndTag ErrorCode = "stray-end-tag"
+	// CodeMismatchedEndTag is an end tag that doesn't close
+	// the element that was opened last.
+	CodeMismatchedEndTag ErrorCode = "mismatched-end-tag"
+	// CodeUnclosedTag is an element that is never closed.
+	CodeUnclosedTag ErrorCode = "unclosed-tag"
+	// CodeInternal is a bug in the formatter, or in one of
+	// its script formatters, that made it panic.
+	CodeInternal ErrorCode = "internal"
+)
+
 // FmtError is a formatting error.
+// Line and Column count from 1.
 type FmtError struct {
 	Msg      string
 	FileName string
 	Line     int
 	Column   int
+	// Code is the kind of error, if it's one of the above.
+	Code ErrorCode
 }
 
 func (e FmtError) Error() string {
@@ -2,6 +2,7 @@ package vugufmt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,23 +10,59 @@ import (
 	"strings"
 
 	"github.com/erinpentecost/vugufmt/htmlx"
-
-	"golang.org/x/net/html/atom"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+	"github.com/erinpentecost/vugufmt/srcmap"
 )
 
 // Formatter allows you to format vugu files.
 type Formatter struct {
-	// ScriptFormatters maps script blocks to formatting
-	// functions.
-	// For each type of script block,
-	// we can run it through the supplied function.
-	// If the function returns error, we should
+	// ScriptFormatters maps script blocks to formatters.
+	// For each type of script block, in lower case,
+	// we can run it through the supplied formatter.
+	// If the formatter returns error, we should
 	// not accept the output written to the writer.
 	// You can add your own custom one for JS, for
 	// example. If you want to use gofmt or goimports,
 	// see how to apply options in NewFormatter.
 	ScriptFormatters map[string]func([]byte) ([]byte, *FmtError)
-	StyleFormatter   func([]byte) ([]byte, *FmtError)
+	// Scripts maps script blocks to formatters like ScriptFormatters
+	// does, but its formatters are given the context and where the
+	// block is too. They take precedence over ScriptFormatters,
+	// and the options in this package add theirs here.
+	Scripts        map[string]ScriptFormatter
+	StyleFormatter func([]byte) ([]byte, *FmtError)
+	// Attributes controls how start tag attributes are written.
+	Attributes AttributeOptions
+	// MaxWidth is the preferred maximum line width. If it's set,
+	// the whole document is laid out again to fit in it, rather
+	// than only its script and style blocks being formatted.
+	// Zero means lines can be as long as they like.
+	MaxWidth int
+	// Whitespace is which whitespace can be changed when
+	// the document is laid out to fit in MaxWidth.
+	Whitespace WhitespaceSensitivity
+	// Reflow wraps text and comments to fit in MaxWidth.
+	Reflow bool
+	// Indent is one level of indentation.
+	// It is four spaces if not set.
+	Indent string
+	// LineEnding is how the lines of formatted files end.
+	LineEnding LineEnding
+	// StripBOM removes the UTF-8 byte order mark from the
+	// start of files. It is kept by default.
+	StripBOM bool
+	// Encoding is the encoding formatted files are written in,
+	// like "utf-8". Files are read in whatever encoding their
+	// byte order mark or <meta charset> says, and if it's empty,
+	// they're written back in that one.
+	Encoding string
+	// AutoFix repairs broken tag structure, like missing end
+	// tags, the way browsers do, rather than failing on it.
+	AutoFix bool
+	// Diagnostic is called with problems that don't stop
+	// a file from being formatted, like mixed line endings,
+	// and with the repairs that AutoFix makes.
+	Diagnostic func(*FmtError)
 }
 
 // NewFormatter creates a new formatter.
@@ -33,7 +70,8 @@ type Formatter struct {
 // Pass in vugufmt.UseGoImports to use goimports.
 func NewFormatter(opts ...func(*Formatter)) *Formatter {
 	f := &Formatter{
-		ScriptFormatters: make(map[string](func([]byte) ([]byte, *FmtError))),
+		ScriptFormatters: make(map[string]func([]byte) ([]byte, *FmtError)),
+		Scripts:          make(map[string]ScriptFormatter),
 	}
 
 	// apply options
@@ -46,14 +84,43 @@ func NewFormatter(opts ...func(*Formatter)) *Formatter {
 
 // FormatScript formats script text nodes.
 func (f *Formatter) FormatScript(scriptType string, scriptContent []byte) ([]byte, *FmtError) {
-	if f.ScriptFormatters == nil {
-		return scriptContent, nil
-	}
-	fn, ok := f.ScriptFormatters[strings.ToLower(scriptType)]
+	return f.formatScript(context.Background(), ScriptRequest{Type: strings.ToLower(scriptType), Src: scriptContent})
+}
+
+// formatScript runs req through the formatter for its type.
+// Errors are positioned in req.Src.
+func (f *Formatter) formatScript(ctx context.Context, req ScriptRequest) ([]byte, *FmtError) {
+	sf, ok := f.scriptFormatter(req.Type)
 	if !ok {
-		return scriptContent, nil
+		return req.Src, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return req.Src, &FmtError{Msg: err.Error()}
+	}
+	run := func(src []byte) ([]byte, *FmtError) {
+		r := req
+		r.Src = src
+		res, err := sf.Format(ctx, r)
+		if err != nil {
+			return src, scriptError(err)
+		}
+		return res.Src, nil
 	}
-	return fn(scriptContent)
+	if req.Type == goScriptType {
+		return formatGo(run, req.Src)
+	}
+	return run(req.Src)
+}
+
+// scriptFormatter returns the formatter for script blocks of type t.
+func (f *Formatter) scriptFormatter(t string) (ScriptFormatter, bool) {
+	if sf, ok := f.Scripts[t]; ok && sf != nil {
+		return sf, true
+	}
+	if fn, ok := f.ScriptFormatters[t]; ok && fn != nil {
+		return ScriptFunc(fn), true
+	}
+	return nil, false
 }
 
 // FormatStyle formats script text nodes.
@@ -66,111 +133,328 @@ func (f *Formatter) FormatStyle(styleContent []byte) ([]byte, *FmtError) {
 
 // FormatHTML formats script and css nodes.
 func (f *Formatter) FormatHTML(filename string, in io.Reader, out io.Writer) *FmtError {
+	return f.FormatHTMLContext(context.Background(), filename, in, out)
+}
+
+// FormatHTMLContext is FormatHTML with a context, which is passed
+// on to the script formatters. Formatting stops with an error
+// if ctx is canceled.
+func (f *Formatter) FormatHTMLContext(ctx context.Context, filename string, in io.Reader, out io.Writer) (ferr *FmtError) {
+	defer recoverPanic(filename, nil, &ferr)
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	s, ferr := f.readSource(filename, src)
+	if ferr != nil {
+		return ferr
+	}
+
+	var buf bytes.Buffer
+	if ferr := f.formatHTML(ctx, filename, bytes.NewReader(s.text), &buf, wholeFile); ferr != nil {
+		return ferr
+	}
+	res, ferr := f.writeSource(filename, s, buf.Bytes())
+	if ferr != nil {
+		return ferr
+	}
+	if _, err := out.Write(res); err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	return nil
+}
+
+// fragment is where the input to formatHTML is in its file.
+type fragment struct {
+	// linePrefix is what comes before it on its first line.
+	linePrefix []byte
+	// region is where it starts in the file.
+	region srcmap.Region
+}
+
+// wholeFile is the fragment of input that is a whole file.
+var wholeFile = fragment{region: srcmap.Region{Start: srcmap.Position{Line: 1, Column: 1}}}
+
+// formatHTML is FormatHTML for input that is a fragment of a
+// file, which needn't start at the beginning of a line. Errors
+// are positioned in the fragment.
+func (f *Formatter) formatHTML(ctx context.Context, filename string, in io.Reader, out io.Writer, frag fragment) *FmtError {
+	err := f.layoutHTML(ctx, filename, in, out, frag)
+	if err != nil {
+		err.FileName = filename
+	}
+	return err
+}
+
+func (f *Formatter) layoutHTML(ctx context.Context, filename string, in io.Reader, out io.Writer, frag fragment) *FmtError {
+	if f.MaxWidth > 0 {
+		l := &layoutWriter{f: f}
+		if err := f.walkHTML(ctx, filename, in, frag, l); err != nil {
+			return err
+		}
+		if err := l.print(out, frag.linePrefix); err != nil {
+			return &FmtError{Msg: err.Error(), FileName: filename}
+		}
+		return nil
+	}
+	return f.walkHTML(ctx, filename, in, frag, &streamWriter{
+		f: f,
+		w: &lineWriter{w: out, line: append([]byte(nil), frag.linePrefix...)},
+	})
+}
+
+// nodeWriter writes out the tokens of a document as walkHTML
+// goes through them.
+type nodeWriter interface {
+	// startTag is a start tag or a self-closing tag.
+	startTag(raw []byte, attrs []htmlx.RawAttribute, tok *htmlx.Token)
+	endTag(raw []byte)
+	// text is a text node. It is verbatim if it is the
+	// contents of a script or style block.
+	text(raw []byte, verbatim bool)
+	// other is everything else, like comments and doctypes.
+	other(raw []byte)
+	// verbatim is any token that has to be written as it is,
+	// because formatting is turned off for it.
+	verbatim(raw []byte)
+}
+
+// walkHTML checks the structure of a document, formats
+// its script and style blocks, and passes it all on to w.
+func (f *Formatter) walkHTML(ctx context.Context, filename string, in io.Reader, frag fragment, w nodeWriter) (err *FmtError) {
 	izer := htmlx.NewTokenizer(in)
-	ts := tokenStack{}
+	// names are reported the way they are written,
+	// like the Vugu component tag <main:MyButton>.
+	izer.PreserveCase(true)
+	var structure htmlx.Structure
+	quiet := newSuppression()
+	// at is the token being worked on, which is
+	// where any panic is reported.
+	var at htmlx.Token
+	defer recoverPanic(filename, &at, &err)
+	// offset is where the current token starts.
+	offset := 0
+	// line is the current line up to the current token, and
+	// indent is the indentation of the last script tag's line.
+	line := append([]byte(nil), frag.linePrefix...)
+	indent := ""
 
-	curTok := htmlx.Token{}
 	for {
 		curTokType := izer.Next()
 
 		// quit on errors.
 		if curTokType == htmlx.ErrorToken {
-			if err := izer.Err(); err != nil {
-				if err != io.EOF {
-					return &FmtError{
-						Msg:    err.Error(),
-						Line:   curTok.Line,
-						Column: curTok.Column,
-					}
-				}
-				// it's ok if we hit the end,
-				// provided the stack is empty
-				if len(ts) == 0 {
-					return nil
-				}
-				return &FmtError{
-					Msg:    "missing end tags",
-					Line:   curTok.Line,
-					Column: curTok.Column,
-				}
+			tok := izer.Token()
+			switch err := izer.Err(); {
+			case err != io.EOF:
+				return syntaxError(&tok, "%s", err)
+			case len(izer.RawData()) > 0:
+				// a tag that the file ends in the
+				// middle of would be lost.
+				return syntaxError(&tok, "unexpected end of file in a tag")
 			}
-			return &FmtError{
-				Msg:    "tokenization error",
-				Line:   curTok.Line,
-				Column: curTok.Column,
+			// it's ok if we hit the end,
+			// provided every element is closed
+			if err := structure.End(); err != nil {
+				return structureError(err)
 			}
+			return nil
 		}
 
+		// Token() rewrites some of the raw data in place, so it has to be
+		// copied first. The same goes for the raw attributes.
+		raw := append([]byte(nil), izer.RawData()...)
+		rawAttrs := izer.RawAttrs()
 		curTok := izer.Token()
+		at = curTok
+		offset += len(raw)
+		if curTokType == htmlx.StartTagToken && curTok.DataAtom == atom.Script {
+			indent = string(leadingSpace(line))
+		}
+		if i := bytes.LastIndexByte(raw, '\n'); i >= 0 {
+			line = append(line[:0], raw[i+1:]...)
+		} else {
+			line = append(line, raw...)
+		}
 
-		raw := izer.RawData()
-		// add or remove tokens from the stack
+		// open or close elements
 		switch curTokType {
 		case htmlx.StartTagToken:
-			ts.push(&curTok)
-			out.Write(raw)
+			structure.Open(&curTok, offset-len(raw))
 		case htmlx.EndTagToken:
-			lastPushed := ts.pop()
-			if lastPushed.DataAtom != curTok.DataAtom {
-				return &FmtError{
-					Msg:    fmt.Sprintf("mismatched ending tag (expected %s, found %s)", lastPushed.Data, curTok.Data),
-					Line:   curTok.Line,
-					Column: curTok.Column,
-				}
+			if err := structure.Close(&curTok, offset-len(raw)); err != nil {
+				return structureError(err)
 			}
-			out.Write(raw)
+		}
+
+		// parts that have formatting turned off are left alone.
+		if quiet.quiet(curTokType, raw, structure.Depth()) {
+			w.verbatim(raw)
+			continue
+		}
+
+		switch curTokType {
+		case htmlx.StartTagToken, htmlx.SelfClosingTagToken:
+			w.startTag(raw, rawAttrs, &curTok)
+		case htmlx.EndTagToken:
+			w.endTag(raw)
 		case htmlx.TextToken:
-			parent := ts.top()
+			parent := structure.Top()
 			if parent == nil {
-				out.Write(raw)
+				w.text(raw, false)
 				//return fmt.Errorf("%s:%v:%v: orphaned text node",
 				//	filename, curTok.Line, curTok.Column)
 			} else if parent.DataAtom == atom.Script {
 				// determine the type of the script
 				scriptType := ""
 				for _, st := range parent.Attr {
-					if st.Key == "type" {
+					if strings.EqualFold(st.Key, "type") {
 						scriptType = st.Val
 					}
 				}
 
 				// hey we are in a script text node
-				fmtr, err := f.FormatScript(scriptType, raw)
+				region := textRegion(&curTok, offset-len(raw), raw)
+				fmtr, err := f.formatScript(ctx, ScriptRequest{
+					Filename: filename,
+					Type:     strings.ToLower(scriptType),
+					Tag:      *parent,
+					Src:      raw,
+					Indent:   indent,
+					Region:   srcmap.New(frag.region.ToHost(region.Start), raw),
+				})
 				// Exit out on error.
 				if err != nil {
-					err.Line += curTok.Line
 					err.FileName = filename
-					return err
+					return regionError(region, err)
 				}
-				out.Write(fmtr)
+				w.text(fmtr, true)
 
 			} else if parent.DataAtom == atom.Style {
 				// hey we are in a CSS text node
 				fmtr, err := f.FormatStyle(raw)
 				if err != nil {
-					return &FmtError{
-						Msg:    err.Error(),
-						Line:   curTok.Line,
-						Column: curTok.Column,
-					}
+					err.FileName = filename
+					return regionError(textRegion(&curTok, offset-len(raw), raw), err)
 				}
-				out.Write(fmtr)
+				w.text(fmtr, true)
 			} else {
 				// we are in some other text node we don't care about.
-				out.Write(raw)
+				w.text(raw, false)
 			}
 		default:
-			out.Write(raw)
+			w.other(raw)
 		}
 	}
 }
 
+// streamWriter writes tokens out as soon as it gets them,
+// leaving everything but the attributes as it was.
+type streamWriter struct {
+	f *Formatter
+	w *lineWriter
+}
+
+func (s *streamWriter) startTag(raw []byte, attrs []htmlx.RawAttribute, tok *htmlx.Token) {
+	s.f.writeStartTag(s.w, raw, attrs)
+}
+
+func (s *streamWriter) endTag(raw []byte) {
+	s.w.Write(raw)
+}
+
+func (s *streamWriter) text(raw []byte, verbatim bool) {
+	s.w.Write(raw)
+}
+
+func (s *streamWriter) other(raw []byte) {
+	s.w.Write(raw)
+}
+
+func (s *streamWriter) verbatim(raw []byte) {
+	s.w.Write(raw)
+}
+
+// tokenError is an error at tok. Tokens count lines
+// and columns from 0, and errors count them from 1.
+func tokenError(tok *htmlx.Token, format string, args ...interface{}) *FmtError {
+	return &FmtError{
+		Msg:    fmt.Sprintf(format, args...),
+		Line:   tok.Line + 1,
+		Column: tok.Column + 1,
+	}
+}
+
+// textRegion is the region of raw, the text of tok,
+// which starts offset bytes into the file.
+func textRegion(tok *htmlx.Token, offset int, raw []byte) srcmap.Region {
+	return srcmap.New(srcmap.Position{Offset: offset, Line: tok.Line + 1, Column: tok.Column + 1}, raw)
+}
+
+// regionError moves err from where it is in the text of r
+// to where that is in the file. An error without a position
+// is put at the start of r.
+func regionError(r srcmap.Region, err *FmtError) *FmtError {
+	p := r.ToHost(srcmap.Position{Line: err.Line, Column: err.Column})
+	if err.Line > 0 && err.Column == 0 {
+		// only the line is known.
+		p.Column = 0
+	}
+	err.Line, err.Column = p.Line, p.Column
+	return err
+}
+
+// syntaxError is a CodeSyntax error at tok.
+func syntaxError(tok *htmlx.Token, format string, args ...interface{}) *FmtError {
+	err := tokenError(tok, format, args...)
+	err.Code = CodeSyntax
+	return err
+}
+
+// recoverPanic turns a panic into a CodeInternal error in *err, so
+// that one bad file can't stop a program that formats many of them.
+// tok, if it isn't nil, is where the formatter had got to.
+func recoverPanic(filename string, tok *htmlx.Token, err **FmtError) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	e := &FmtError{Msg: fmt.Sprintf("internal error: %v", r)}
+	if tok != nil {
+		e = tokenError(tok, "internal error: %v", r)
+	}
+	e.FileName = filename
+	e.Code = CodeInternal
+	*err = e
+}
+
+// position is where tok starts, the way errors show it.
+func position(tok *htmlx.Token) string {
+	return fmt.Sprintf("%d:%d", tok.Line+1, tok.Column+1)
+}
+
+// structureError is the FmtError for err, a problem
+// with the structure of a document.
+func structureError(err *htmlx.SyntaxError) *FmtError {
+	return &FmtError{Msg: err.Msg, Line: err.Pos.Line, Column: err.Pos.Column, Code: structureCodes[err.Kind]}
+}
+
+var structureCodes = map[htmlx.SyntaxErrorKind]ErrorCode{
+	htmlx.SyntaxInvalid:          CodeSyntax,
+	htmlx.SyntaxStrayEndTag:      CodeStrayEndTag,
+	htmlx.SyntaxMismatchedEndTag: CodeMismatchedEndTag,
+	htmlx.SyntaxUnclosedTag:      CodeUnclosedTag,
+}
+
 // tokenStack is a stack of nodes.
 type tokenStack []*htmlx.Token
 
-// pop pops the stack. It will panic if s is empty.
+// pop pops the stack, or returns nil if s is empty.
 func (s *tokenStack) pop() *htmlx.Token {
 	i := len(*s)
+	if i == 0 {
+		return nil
+	}
 	n := (*s)[i-1]
 	*s = (*s)[:i-1]
 	return n
@@ -227,6 +511,12 @@ func (s *tokenStack) remove(n *htmlx.Token) {
 // and (*, notnil) when the difference can't be determined.
 // filename is optional, but helps with generating useful output.
 func (f *Formatter) Diff(filename string, input io.Reader, output io.Writer) (bool, error) {
+	return f.DiffContext(context.Background(), filename, input, output)
+}
+
+// DiffContext is Diff with a context, which is passed
+// on as FormatHTMLContext's is.
+func (f *Formatter) DiffContext(ctx context.Context, filename string, input io.Reader, output io.Writer) (bool, error) {
 	if filename == "" {
 		filename = "<not set>"
 	}
@@ -236,11 +526,38 @@ func (f *Formatter) Diff(filename string, input io.Reader, output io.Writer) (bo
 	if err != nil {
 		return false, err
 	}
-	if err := f.FormatHTML(filename, bytes.NewReader(src), &resBuff); err != nil {
+	if err := f.FormatHTMLContext(ctx, filename, bytes.NewReader(src), &resBuff); err != nil {
 		return false, err
 	}
-	res := resBuff.Bytes()
+	return writeDiff(filename, src, resBuff.Bytes(), output)
+}
+
+// DiffRange is like Diff, but only considers the lines
+// that FormatRange would format.
+func (f *Formatter) DiffRange(filename string, input io.Reader, ranges []LineRange, output io.Writer) (bool, error) {
+	return f.DiffRangeContext(context.Background(), filename, input, ranges, output)
+}
+
+// DiffRangeContext is DiffRange with a context, which is passed
+// on as FormatRangeContext's is.
+func (f *Formatter) DiffRangeContext(ctx context.Context, filename string, input io.Reader, ranges []LineRange, output io.Writer) (bool, error) {
+	if filename == "" {
+		filename = "<not set>"
+	}
+
+	src, err := ioutil.ReadAll(input)
+	if err != nil {
+		return false, err
+	}
+	res, ferr := f.FormatRangeContext(ctx, filename, src, ranges)
+	if ferr != nil {
+		return false, ferr
+	}
+	return writeDiff(filename, src, res, output)
+}
 
+// writeDiff writes the difference between src and res to output.
+func writeDiff(filename string, src, res []byte, output io.Writer) (bool, error) {
 	// No difference!
 	if bytes.Equal(src, res) {
 		return false, nil
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOptsCustom(t *testing.T) {
@@ -24,19 +25,19 @@ func TestOptsCustom(t *testing.T) {
 func TestOptsGoFmt(t *testing.T) {
 	gofmt := UseGoFmt(false)
 	formatter := NewFormatter(gofmt)
-	assert.NotNil(t, formatter.ScriptFormatters["application/x-go"])
+	assert.NotNil(t, formatter.Scripts["application/x-go"])
 }
 
 func TestOptsGoFmtSimple(t *testing.T) {
 	gofmt := UseGoFmt(true)
 	formatter := NewFormatter(gofmt)
-	assert.NotNil(t, formatter.ScriptFormatters["application/x-go"])
+	assert.NotNil(t, formatter.Scripts["application/x-go"])
 }
 
 func TestOptsGoImports(t *testing.T) {
 	goimports := UseGoImports
 	formatter := NewFormatter(goimports)
-	assert.NotNil(t, goimports, formatter.ScriptFormatters["application/x-go"])
+	assert.NotNil(t, goimports, formatter.Scripts["application/x-go"])
 }
 
 func TestVuguFmtNoError(t *testing.T) {
@@ -125,3 +126,127 @@ func TestBadHTML(t *testing.T) {
 	prettyVersion := buf.String()
 	assert.NotEqual(t, testCode, prettyVersion)
 }
+
+func TestStrayEndTag(t *testing.T) {
+	formatter := NewFormatter()
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("", strings.NewReader("<div></div></div>"), &buf)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Msg, "unexpected ending tag </div>")
+	assert.Equal(t, 1, err.Line)
+	assert.Equal(t, 12, err.Column)
+	assert.Equal(t, CodeStrayEndTag, err.Code)
+
+	// even as the very first tag.
+	_, err = formatter.FormatRange("root.vugu", []byte("</div>\n<p></p>\n"), []LineRange{{Start: 2, End: 2}})
+	require.NotNil(t, err)
+	assert.Equal(t, "root.vugu:1:1: unexpected ending tag </div>", err.Error())
+	assert.Equal(t, CodeStrayEndTag, err.Code)
+
+	var s tokenStack
+	assert.Nil(t, s.pop())
+}
+
+func TestUnclosedTags(t *testing.T) {
+	formatter := NewFormatter()
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("root.vugu", strings.NewReader("<div>\n    <p>\n<span>a</span>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "root.vugu:2:5: missing end tags: unclosed <p> opened at 2:5, unclosed <div> opened at 1:1", err.Error())
+	assert.Equal(t, CodeUnclosedTag, err.Code)
+
+	err = formatter.FormatHTML("root.vugu", strings.NewReader("<div>\n  <my-comp>\n  </my-other>\n</div>"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "root.vugu:3:3: mismatched ending tag (expected </my-comp> for the <my-comp> opened at 2:3, found </my-other>)", err.Error())
+	assert.Equal(t, CodeMismatchedEndTag, err.Code)
+}
+
+func TestComponentNames(t *testing.T) {
+	formatter := NewFormatter()
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("root.vugu", strings.NewReader("<div>\n<main:MyButton :DataSource='x'>\n</div>"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "root.vugu:3:1: mismatched ending tag (expected </main:MyButton> for the <main:MyButton> opened at 2:1, found </div>)", err.Error())
+
+	// end tags match whatever their case.
+	src := "<MyComp><B>a</b></mycomp>"
+	assert.Equal(t, src, formatString(t, formatter, src))
+	assert.Equal(t, "<div><MyComp>a</MyComp></div>", string(fixStructure("", []byte("<div><MyComp>a</div>"), nil)))
+}
+
+func TestTruncatedTag(t *testing.T) {
+	// the tag at the end mustn't just disappear.
+	formatter := NewFormatter()
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("", strings.NewReader("<div>x</div>\n<p class"), &buf)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, err.Line)
+	assert.Equal(t, CodeSyntax, err.Code)
+}
+
+func TestPanicRecovered(t *testing.T) {
+	formatter := NewFormatter()
+	formatter.ScriptFormatters["application/x-go"] = func([]byte) ([]byte, *FmtError) {
+		panic("oops")
+	}
+	src := "<div></div>\n<script type=\"application/x-go\">\nvar x = 1\n</script>\n"
+
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("root.vugu", strings.NewReader(src), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, FmtError{Msg: "internal error: oops", FileName: "root.vugu", Line: 2, Column: 33, Code: CodeInternal}, *err)
+	assert.Empty(t, buf.String())
+
+	_, err = formatter.FormatRange("root.vugu", []byte(src), []LineRange{{Start: 3, End: 3}})
+	require.NotNil(t, err)
+	assert.Equal(t, CodeInternal, err.Code)
+
+	// panics outside of the document are caught too.
+	formatter = NewFormatter(UseMaxWidth(40))
+	formatter.Diagnostic = func(*FmtError) {
+		panic("oops")
+	}
+	err = formatter.FormatHTML("root.vugu", strings.NewReader("<p>a</p>\r\n<p>b</p>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, FmtError{Msg: "internal error: oops", FileName: "root.vugu", Code: CodeInternal}, *err)
+}
+
+func TestEmbeddedErrorPositions(t *testing.T) {
+	// failAt fails with an error at line:column of the text it's given.
+	failAt := func(line, column int) func([]byte) ([]byte, *FmtError) {
+		return func(src []byte) ([]byte, *FmtError) {
+			return src, &FmtError{Msg: "bad", Line: line, Column: column}
+		}
+	}
+	for _, tc := range []struct {
+		name         string
+		src          string
+		line, column int
+		want         string
+	}{
+		{"first line", "<div>\n  <script type=\"text/x\">a b</script>\n</div>\n", 1, 3, "x.vugu:2:27: bad"},
+		{"later line", "<script type=\"text/x\">\n  a\n  b</script>\n", 3, 3, "x.vugu:3:3: bad"},
+		{"crlf", "<div>\r\n<script type=\"text/x\">a\r\n  b</script>\r\n</div>\r\n", 2, 3, "x.vugu:3:3: bad"},
+		{"crlf first line", "<div>\r\n<script type=\"text/x\">a\r\n  b</script>\r\n</div>\r\n", 1, 1, "x.vugu:2:23: bad"},
+		{"tab", "<div>\n\t<style>\ta {}</style>\n</div>\n", 1, 2, "x.vugu:2:10: bad"},
+		{"line only", "<div>\n  <script type=\"text/x\">a b</script>\n</div>\n", 1, 0, "x.vugu:2:0: bad"},
+		{"no position", "<div>\n  <style>a {}</style>\n</div>\n", 0, 0, "x.vugu:2:10: bad"},
+	} {
+		formatter := NewFormatter()
+		formatter.ScriptFormatters["text/x"] = failAt(tc.line, tc.column)
+		formatter.StyleFormatter = failAt(tc.line, tc.column)
+
+		var buf bytes.Buffer
+		err := formatter.FormatHTML("x.vugu", strings.NewReader(tc.src), &buf)
+		require.NotNil(t, err, tc.name)
+		assert.Equal(t, tc.want, err.Error(), tc.name)
+	}
+
+	// fragments of a range don't start at the start of the file.
+	formatter := NewFormatter()
+	formatter.ScriptFormatters["text/x"] = failAt(1, 3)
+	src := "<div>\n  <p>a</p>\n  <script type=\"text/x\">a b</script>\n</div>\n"
+	_, err := formatter.FormatRange("x.vugu", []byte(src), []LineRange{{Start: 3, End: 3}})
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:3:27: bad", err.Error())
+}
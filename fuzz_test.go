@@ -0,0 +1,48 @@
+package vugufmt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func FuzzFormatHTML(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*", "*.vugu"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(src)
+	}
+	for _, src := range whitespaceTests {
+		f.Add([]byte(src))
+	}
+
+	formatters := []*Formatter{
+		NewFormatter(),
+		NewFormatter(UseAttributeOptions(AttributeOptions{Quote: '"', Sort: true, WrapAfter: 2})),
+		NewFormatter(UseMaxWidth(20), UseWhitespaceSensitivity(WhitespaceCSS)),
+		NewFormatter(UseMaxWidth(10), UseReflow(true)),
+		NewFormatter(UseAutoFix, UseMaxWidth(40), UseWhitespaceSensitivity(WhitespaceCSS)),
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		for _, fmtr := range formatters {
+			var res bytes.Buffer
+			if err := fmtr.FormatHTML("", bytes.NewReader(src), &res); err != nil {
+				continue
+			}
+			var again bytes.Buffer
+			if err := fmtr.FormatHTML("", bytes.NewReader(res.Bytes()), &again); err != nil {
+				t.Fatalf("formatting %q gave %q, which doesn't format: %v", src, res.Bytes(), err)
+			}
+			if !bytes.Equal(res.Bytes(), again.Bytes()) {
+				t.Fatalf("formatting %q gave %q, and formatting that gave %q", src, res.Bytes(), again.Bytes())
+			}
+		}
+	})
+}
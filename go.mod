@@ -1,6 +1,6 @@
 module github.com/erinpentecost/vugufmt
 
-go 1.12
+go 1.20
 
 require (
 	github.com/stretchr/testify v1.3.0
@@ -8,6 +8,11 @@ require (
 	golang.org/x/text v0.3.0
 )
 
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
+
 replace github.com/erinpentecost/vugufmt/htmlx => ./htmlx
 
 replace github.com/erinpentecost/vugufmt/htmlx/atom => ./htmlx/atom
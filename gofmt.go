@@ -2,6 +2,7 @@ package vugufmt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -13,18 +14,33 @@ import (
 func UseGoFmt(simplifyAST bool) func(*Formatter) {
 
 	return func(f *Formatter) {
-		f.ScriptFormatters["application/x-go"] = func(input []byte) ([]byte, *FmtError) {
-			return runGoFmt(input, simplifyAST)
-		}
+		f.Scripts["application/x-go"] = goFmt{simplify: simplifyAST}
 	}
 }
 
+// goFmt runs x-go blocks through gofmt.
+type goFmt struct {
+	simplify bool
+}
+
+func (g goFmt) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	res, err := runGoFmtContext(ctx, req.Src, g.simplify)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+	return ScriptResult{Src: res}, nil
+}
+
 func runGoFmt(input []byte, simplify bool) ([]byte, *FmtError) {
+	return runGoFmtContext(context.Background(), input, simplify)
+}
+
+func runGoFmtContext(ctx context.Context, input []byte, simplify bool) ([]byte, *FmtError) {
 	// build up command to run
-	cmd := exec.Command("gofmt")
+	cmd := exec.CommandContext(ctx, "gofmt")
 
 	if simplify {
-		cmd.Args = []string{"-s"}
+		cmd.Args = append(cmd.Args, "-s")
 	}
 
 	var resBuff, errBuff bytes.Buffer
@@ -51,6 +67,9 @@ func runGoFmt(input []byte, simplify bool) ([]byte, *FmtError) {
 	res := resBuff.Bytes()
 
 	// Wrap the output in an error.
+	if ctx.Err() != nil {
+		return input, &FmtError{Msg: fmt.Sprintf("gofmt: %s", ctx.Err())}
+	}
 	if err != nil {
 		return input, fromGoFmt(string(errBuff.String()))
 	}
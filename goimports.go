@@ -2,21 +2,36 @@ package vugufmt
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 )
 
 // UseGoImports sets the formatter to use goimports on x-go blocks.
+// Imports are looked for as if the block were in the directory of
+// the file being formatted, so that its module is found.
 func UseGoImports(f *Formatter) {
-	f.ScriptFormatters["application/x-go"] = func(input []byte) ([]byte, *FmtError) {
-		return runGoImports(input)
+	f.Scripts["application/x-go"] = goImports{}
+}
+
+// goImports runs x-go blocks through goimports.
+type goImports struct{}
+
+func (goImports) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	res, err := runGoImports(ctx, req.Filename, req.Src)
+	if err != nil {
+		return ScriptResult{}, err
 	}
+	return ScriptResult{Src: res}, nil
 }
 
-func runGoImports(input []byte) ([]byte, *FmtError) {
+func runGoImports(ctx context.Context, filename string, input []byte) ([]byte, *FmtError) {
 	// build up command to run
-	cmd := exec.Command("goimports")
+	cmd := exec.CommandContext(ctx, "goimports")
+	if filename != "" {
+		cmd.Args = append(cmd.Args, "-srcdir", filename)
+	}
 
 	var resBuff bytes.Buffer
 
@@ -42,6 +57,9 @@ func runGoImports(input []byte) ([]byte, *FmtError) {
 	res := resBuff.Bytes()
 
 	// Wrap the output in an error.
+	if ctx.Err() != nil {
+		return input, &FmtError{Msg: fmt.Sprintf("goimports: %s", ctx.Err())}
+	}
 	if err != nil {
 		return input, fromGoFmt(string(res))
 	}
@@ -0,0 +1,181 @@
+package vugufmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/fmt")
+
+// goldenOptions are the formatter options in a <name>.options.json file.
+type goldenOptions struct {
+	GoFmt      bool   `json:"gofmt"`
+	Simplify   bool   `json:"simplify"`
+	GoImports  bool   `json:"goimports"`
+	JS         bool   `json:"js"`
+	Quote      string `json:"quote"`
+	SortAttrs  bool   `json:"sortAttrs"`
+	WrapAttrs  int    `json:"wrapAttrs"`
+	Width      int    `json:"width"`
+	Whitespace string `json:"whitespace"`
+	Reflow     bool   `json:"reflow"`
+	Indent     string `json:"indent"`
+	Fix        bool   `json:"fix"`
+}
+
+func (o goldenOptions) formatter(t *testing.T) *Formatter {
+	var opts []func(*Formatter)
+	switch {
+	case o.GoImports:
+		opts = append(opts, UseGoImports)
+	case o.GoFmt:
+		opts = append(opts, UseGoFmt(o.Simplify))
+	}
+	if o.JS {
+		opts = append(opts, UseJSFmt)
+	}
+
+	attrs := AttributeOptions{Sort: o.SortAttrs, WrapAfter: o.WrapAttrs}
+	switch o.Quote {
+	case "double":
+		attrs.Quote = '"'
+	case "single":
+		attrs.Quote = '\''
+	case "":
+	default:
+		t.Fatalf("quote must be double or single, not %q", o.Quote)
+	}
+	opts = append(opts, UseAttributeOptions(attrs), UseMaxWidth(o.Width), UseReflow(o.Reflow))
+
+	if o.Whitespace != "" {
+		ws, err := ParseWhitespaceSensitivity(o.Whitespace)
+		require.NoError(t, err)
+		opts = append(opts, UseWhitespaceSensitivity(ws))
+	}
+	if o.Fix {
+		opts = append(opts, UseAutoFix)
+	}
+
+	f := NewFormatter(opts...)
+	f.Indent = o.Indent
+	return f
+}
+
+// combinations returns o with every combination of the options
+// that don't have to do with Go code.
+func (o goldenOptions) combinations() []goldenOptions {
+	res := []goldenOptions{o}
+	vary := func(set func(*goldenOptions, int), n int) {
+		var next []goldenOptions
+		for _, c := range res {
+			for i := 0; i < n; i++ {
+				set(&c, i)
+				next = append(next, c)
+			}
+		}
+		res = next
+	}
+	vary(func(c *goldenOptions, i int) { c.Quote = []string{"", "double"}[i] }, 2)
+	vary(func(c *goldenOptions, i int) { c.SortAttrs = i == 1 }, 2)
+	vary(func(c *goldenOptions, i int) { c.WrapAttrs = []int{0, 2}[i] }, 2)
+	vary(func(c *goldenOptions, i int) { c.Width = []int{0, 40}[i] }, 2)
+	vary(func(c *goldenOptions, i int) { c.Whitespace = []string{"strict", "css", "ignore"}[i] }, 3)
+	vary(func(c *goldenOptions, i int) { c.Reflow = i == 1 }, 2)
+	return res
+}
+
+// goldenCase is a testdata/fmt/<name>.input.vugu file and the files next to it.
+type goldenCase struct {
+	name    string
+	input   []byte
+	options goldenOptions
+}
+
+func (c goldenCase) path(suffix string) string {
+	return filepath.Join("testdata", "fmt", c.name+suffix)
+}
+
+func goldenCases(t *testing.T) []goldenCase {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "fmt", "*.input.vugu"))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	var cases []goldenCase
+	for _, input := range inputs {
+		c := goldenCase{name: strings.TrimSuffix(filepath.Base(input), ".input.vugu")}
+		c.input, err = ioutil.ReadFile(input)
+		require.NoError(t, err)
+		if b, err := ioutil.ReadFile(c.path(".options.json")); err == nil {
+			require.NoError(t, json.Unmarshal(b, &c.options), c.path(".options.json"))
+		} else if !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		cases = append(cases, c)
+	}
+	return cases
+}
+
+// formatGolden formats src, and returns the result
+// or the text of the error it fails with.
+func formatGolden(f *Formatter, name string, src []byte) ([]byte, string) {
+	var buf bytes.Buffer
+	if err := f.FormatHTML(name, bytes.NewReader(src), &buf); err != nil {
+		return nil, err.Error() + "\n"
+	}
+	return buf.Bytes(), ""
+}
+
+func TestGolden(t *testing.T) {
+	for _, c := range goldenCases(t) {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			res, errText := formatGolden(c.options.formatter(t), c.name+".input.vugu", c.input)
+			if *update {
+				os.Remove(c.path(".golden.vugu"))
+				os.Remove(c.path(".errors.txt"))
+				if errText != "" {
+					require.NoError(t, ioutil.WriteFile(c.path(".errors.txt"), []byte(errText), 0644))
+				} else {
+					require.NoError(t, ioutil.WriteFile(c.path(".golden.vugu"), res, 0644))
+				}
+				return
+			}
+
+			if want, err := ioutil.ReadFile(c.path(".errors.txt")); err == nil {
+				assert.Equal(t, string(want), errText)
+				return
+			}
+			require.Empty(t, errText)
+			want, err := ioutil.ReadFile(c.path(".golden.vugu"))
+			require.NoError(t, err, "run go test -update to create it")
+			assert.Equal(t, string(want), string(res))
+		})
+	}
+}
+
+func TestGoldenCombinations(t *testing.T) {
+	// whatever the options are, formatting must be
+	// idempotent and keep what the page shows.
+	for _, c := range goldenCases(t) {
+		if _, err := os.Stat(c.path(".errors.txt")); err == nil {
+			continue
+		}
+		for _, o := range c.options.combinations() {
+			f := o.formatter(t)
+			res, errText := formatGolden(f, c.name, c.input)
+			if !assert.Empty(t, errText, "%s with %+v", c.name, o) {
+				continue
+			}
+			assert.Nil(t, f.Verify(c.name, c.input, res), "%s with %+v:\n%s", c.name, o, res)
+		}
+	}
+}
@@ -2,10 +2,12 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build ignore
 // +build ignore
 
 //go:generate go run gen.go
 //go:generate go run gen.go -test
+//go:generate go run gen.go -info
 
 package main
 
@@ -40,7 +42,10 @@ func identifier(s string) string {
 	return string(b)
 }
 
-var test = flag.Bool("test", false, "generate table_test.go")
+var (
+	test = flag.Bool("test", false, "generate table_test.go")
+	info = flag.Bool("info", false, "generate infotable.go")
+)
 
 func genFile(name string, buf *bytes.Buffer) {
 	b, err := format.Source(buf.Bytes())
@@ -74,6 +79,11 @@ func main() {
 	}
 	all = all[:w]
 
+	if *info {
+		genInfo(all)
+		return
+	}
+
 	if *test {
 		var buf bytes.Buffer
 		fmt.Fprintln(&buf, "// Code generated by go generate gen.go; DO NOT EDIT.\n")
@@ -216,6 +226,77 @@ func main() {
 	fmt.Fprintf(os.Stdout, "%d atoms; %d string bytes + %d tables = %d total data\n", len(all), textsize, datasize, textsize+datasize)
 }
 
+// genInfo writes the facts about elements in infotable.go.
+func genInfo(all []string) {
+	known := map[string]bool{}
+	for _, s := range all {
+		known[s] = true
+	}
+	infos := map[string][]string{}
+	add := func(name, field string) {
+		if !known[name] {
+			fmt.Fprintf(os.Stderr, "%q isn't an atom\n", name)
+			os.Exit(1)
+		}
+		infos[name] = append(infos[name], field)
+	}
+	flags := []struct {
+		field string
+		names []string
+	}{
+		{"Void: true", voidElements},
+		{"RawText: true", rawTextElements},
+		{"EscapableRawText: true", escapableRawTextElements},
+		{"OptionalEnd: true", optionalEndElements},
+		{"PreserveSpace: true", preserveSpaceElements},
+	}
+	for _, f := range flags {
+		for _, name := range f.names {
+			add(name, f.field)
+		}
+	}
+	for display, names := range map[string][]string{
+		"DisplayBlock":    blockElements,
+		"DisplayListItem": listItemElements,
+		"DisplayTable":    tableElements,
+		"DisplayNone":     hiddenElements,
+	} {
+		for _, name := range names {
+			add(name, "Display: "+display)
+		}
+	}
+	for name, ps := range parents {
+		ids := make([]string, len(ps))
+		for i, p := range ps {
+			if !known[p] {
+				fmt.Fprintf(os.Stderr, "%q isn't an atom\n", p)
+				os.Exit(1)
+			}
+			ids[i] = identifier(p)
+		}
+		add(name, "Parents: []Atom{"+strings.Join(ids, ", ")+"}")
+	}
+
+	var names []string
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by go generate gen.go; DO NOT EDIT.\n")
+	fmt.Fprintln(&buf, "//go:generate go run gen.go -info\n")
+	fmt.Fprintln(&buf, "package atom\n")
+	fmt.Fprintln(&buf, "var infoTable = map[Atom]ElementInfo{")
+	for _, name := range names {
+		fields := infos[name]
+		sort.Strings(fields)
+		fmt.Fprintf(&buf, "\t%s: {%s},\n", identifier(name), strings.Join(fields, ", "))
+	}
+	fmt.Fprintln(&buf, "}")
+	genFile("infotable.go", &buf)
+}
+
 type byLen []string
 
 func (x byLen) Less(i, j int) bool { return len(x[i]) > len(x[j]) }
@@ -710,3 +791,198 @@ var extra = []string{
 	"tt",
 	"xmp",
 }
+
+// The facts about elements were taken from
+// https://html.spec.whatwg.org/multipage/syntax.html#elements-2,
+// https://html.spec.whatwg.org/multipage/syntax.html#optional-tags,
+// https://html.spec.whatwg.org/multipage/rendering.html and the content
+// models of the elements, as of the same version as the lists above.
+
+// voidElements have no contents and no end tag.
+var voidElements = []string{
+	"area",
+	"base",
+	"br",
+	"col",
+	"embed",
+	"hr",
+	"img",
+	"input",
+	"keygen",
+	"link",
+	"meta",
+	"param",
+	"source",
+	"track",
+	"wbr",
+}
+
+// rawTextElements have text as their contents, up to their end tag,
+// without any character references. The spec's raw text elements are
+// script and style, and the parser reads the rest the same way.
+var rawTextElements = []string{
+	"iframe",
+	"noembed",
+	"noframes",
+	"noscript",
+	"plaintext",
+	"script",
+	"style",
+	"xmp",
+}
+
+// escapableRawTextElements have text with character
+// references as their contents, up to their end tag.
+var escapableRawTextElements = []string{
+	"textarea",
+	"title",
+}
+
+// optionalEndElements can leave out their end tags.
+var optionalEndElements = []string{
+	"body",
+	"caption",
+	"colgroup",
+	"dd",
+	"dt",
+	"head",
+	"html",
+	"li",
+	"optgroup",
+	"option",
+	"p",
+	"rb",
+	"rp",
+	"rt",
+	"rtc",
+	"tbody",
+	"td",
+	"tfoot",
+	"th",
+	"thead",
+	"tr",
+}
+
+// preserveSpaceElements are displayed with their whitespace as it is.
+var preserveSpaceElements = []string{
+	"listing",
+	"plaintext",
+	"pre",
+	"textarea",
+	"xmp",
+}
+
+// blockElements are displayed as blocks by the default style sheet.
+var blockElements = []string{
+	"address",
+	"article",
+	"aside",
+	"blockquote",
+	"body",
+	"center",
+	"dd",
+	"details",
+	"dialog",
+	"dir",
+	"div",
+	"dl",
+	"dt",
+	"fieldset",
+	"figcaption",
+	"figure",
+	"footer",
+	"form",
+	"h1",
+	"h2",
+	"h3",
+	"h4",
+	"h5",
+	"h6",
+	"header",
+	"hgroup",
+	"hr",
+	"html",
+	"legend",
+	"listing",
+	"main",
+	"menu",
+	"nav",
+	"ol",
+	"optgroup",
+	"option",
+	"p",
+	"plaintext",
+	"pre",
+	"section",
+	"summary",
+	"ul",
+	"xmp",
+}
+
+// listItemElements are displayed as list items.
+var listItemElements = []string{
+	"li",
+}
+
+// tableElements are displayed as tables or parts of them.
+var tableElements = []string{
+	"caption",
+	"col",
+	"colgroup",
+	"table",
+	"tbody",
+	"td",
+	"tfoot",
+	"th",
+	"thead",
+	"tr",
+}
+
+// hiddenElements aren't displayed.
+var hiddenElements = []string{
+	"area",
+	"base",
+	"basefont",
+	"datalist",
+	"head",
+	"link",
+	"meta",
+	"noembed",
+	"noframes",
+	"param",
+	"rp",
+	"script",
+	"style",
+	"template",
+	"title",
+}
+
+// parents are the only elements that some elements can be children of.
+var parents = map[string][]string{
+	"body":       {"html"},
+	"caption":    {"table"},
+	"col":        {"colgroup"},
+	"colgroup":   {"table"},
+	"dd":         {"dl", "div"},
+	"dt":         {"dl", "div"},
+	"figcaption": {"figure"},
+	"head":       {"html"},
+	"legend":     {"fieldset"},
+	"li":         {"ol", "ul", "menu"},
+	"optgroup":   {"select"},
+	"option":     {"select", "datalist", "optgroup"},
+	"param":      {"object"},
+	"rb":         {"ruby"},
+	"rp":         {"ruby", "rtc"},
+	"rt":         {"ruby", "rtc"},
+	"rtc":        {"ruby"},
+	"source":     {"audio", "video", "picture"},
+	"summary":    {"details"},
+	"tbody":      {"table"},
+	"td":         {"tr"},
+	"tfoot":      {"table"},
+	"th":         {"tr"},
+	"thead":      {"table"},
+	"tr":         {"table", "thead", "tbody", "tfoot"},
+	"track":      {"audio", "video"},
+}
@@ -0,0 +1,55 @@
+package atom
+
+// Display is how the HTML spec's default style sheet displays an element.
+type Display uint8
+
+const (
+	// DisplayInline elements are laid out in lines of text.
+	// Elements that the spec says nothing about are inline.
+	DisplayInline Display = iota
+	// DisplayBlock elements start on a new line.
+	DisplayBlock
+	// DisplayListItem elements are blocks with a marker, like <li>.
+	DisplayListItem
+	// DisplayTable elements are tables, or their rows,
+	// cells and other parts.
+	DisplayTable
+	// DisplayNone elements aren't displayed at all.
+	DisplayNone
+)
+
+// IsBlock reports whether d starts on a new line,
+// rather than being inline or not displayed.
+func (d Display) IsBlock() bool {
+	return d == DisplayBlock || d == DisplayListItem || d == DisplayTable
+}
+
+// ElementInfo is what the HTML spec says about an element.
+type ElementInfo struct {
+	// Void elements, like <br>, have no contents and no end tag.
+	Void bool
+	// RawText elements, like <script>, have text as their contents,
+	// up to their end tag, without any character references.
+	RawText bool
+	// EscapableRawText elements, like <textarea>, have text with
+	// character references as their contents, up to their end tag.
+	EscapableRawText bool
+	// OptionalEnd elements, like <li>, can leave out their end tags.
+	OptionalEnd bool
+	// PreserveSpace elements, like <pre>, are displayed
+	// with their whitespace as it is.
+	PreserveSpace bool
+	// Display is how the element is displayed by default.
+	Display Display
+	// Parents are the only elements that the element can be a child
+	// of, like <ul> and <ol> for <li>. It is nil if there are no such
+	// restrictions.
+	Parents []Atom
+}
+
+// Info returns what the HTML spec says about the element a. It is the zero
+// ElementInfo, for an inline element that can go anywhere, if a isn't an
+// element or the spec doesn't say anything about it.
+func Info(a Atom) ElementInfo {
+	return infoTable[a]
+}
@@ -0,0 +1,58 @@
+package atom
+
+import "testing"
+
+func TestInfo(t *testing.T) {
+	if !Info(Br).Void || Info(Div).Void {
+		t.Errorf("Info(Br).Void and Info(Div).Void should be true and false")
+	}
+	if !Info(Script).RawText || !Info(Textarea).EscapableRawText || Info(Textarea).RawText {
+		t.Errorf("script should be raw text, and textarea escapable raw text")
+	}
+	if !Info(Li).OptionalEnd || Info(Ul).OptionalEnd {
+		t.Errorf("Info(Li).OptionalEnd and Info(Ul).OptionalEnd should be true and false")
+	}
+	if !Info(Pre).PreserveSpace {
+		t.Errorf("Info(Pre).PreserveSpace should be true")
+	}
+	for _, tc := range []struct {
+		a     Atom
+		want  Display
+		block bool
+	}{
+		{Div, DisplayBlock, true},
+		{Li, DisplayListItem, true},
+		{Td, DisplayTable, true},
+		{Span, DisplayInline, false},
+		{Script, DisplayNone, false},
+		{0, DisplayInline, false},
+	} {
+		if got := Info(tc.a).Display; got != tc.want || got.IsBlock() != tc.block {
+			t.Errorf("Info(%q).Display = %v, want %v", tc.a, got, tc.want)
+		}
+	}
+
+	parents := Info(Li).Parents
+	if len(parents) != 3 || parents[0] != Ol || parents[1] != Ul || parents[2] != Menu {
+		t.Errorf("Info(Li).Parents = %v, want [ol ul menu]", parents)
+	}
+	if Info(Div).Parents != nil {
+		t.Errorf("Info(Div).Parents = %v, want nil", Info(Div).Parents)
+	}
+}
+
+func TestInfoConsistent(t *testing.T) {
+	for a, info := range infoTable {
+		if info.Void && (info.RawText || info.EscapableRawText || info.OptionalEnd) {
+			t.Errorf("%q is void, so it can't have contents or an end tag", a)
+		}
+		if info.RawText && info.EscapableRawText {
+			t.Errorf("%q is both raw text and escapable raw text", a)
+		}
+		for _, p := range info.Parents {
+			if p == 0 || Info(p).Void {
+				t.Errorf("%q can't be a parent of %q", p, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Code generated by go generate gen.go; DO NOT EDIT.
+
+//go:generate go run gen.go -info
+
+package atom
+
+var infoTable = map[Atom]ElementInfo{
+	Address:    {Display: DisplayBlock},
+	Area:       {Display: DisplayNone, Void: true},
+	Article:    {Display: DisplayBlock},
+	Aside:      {Display: DisplayBlock},
+	Base:       {Display: DisplayNone, Void: true},
+	Basefont:   {Display: DisplayNone},
+	Blockquote: {Display: DisplayBlock},
+	Body:       {Display: DisplayBlock, OptionalEnd: true, Parents: []Atom{Html}},
+	Br:         {Void: true},
+	Caption:    {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Table}},
+	Center:     {Display: DisplayBlock},
+	Col:        {Display: DisplayTable, Parents: []Atom{Colgroup}, Void: true},
+	Colgroup:   {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Table}},
+	Datalist:   {Display: DisplayNone},
+	Dd:         {Display: DisplayBlock, OptionalEnd: true, Parents: []Atom{Dl, Div}},
+	Details:    {Display: DisplayBlock},
+	Dialog:     {Display: DisplayBlock},
+	Dir:        {Display: DisplayBlock},
+	Div:        {Display: DisplayBlock},
+	Dl:         {Display: DisplayBlock},
+	Dt:         {Display: DisplayBlock, OptionalEnd: true, Parents: []Atom{Dl, Div}},
+	Embed:      {Void: true},
+	Fieldset:   {Display: DisplayBlock},
+	Figcaption: {Display: DisplayBlock, Parents: []Atom{Figure}},
+	Figure:     {Display: DisplayBlock},
+	Footer:     {Display: DisplayBlock},
+	Form:       {Display: DisplayBlock},
+	H1:         {Display: DisplayBlock},
+	H2:         {Display: DisplayBlock},
+	H3:         {Display: DisplayBlock},
+	H4:         {Display: DisplayBlock},
+	H5:         {Display: DisplayBlock},
+	H6:         {Display: DisplayBlock},
+	Head:       {Display: DisplayNone, OptionalEnd: true, Parents: []Atom{Html}},
+	Header:     {Display: DisplayBlock},
+	Hgroup:     {Display: DisplayBlock},
+	Hr:         {Display: DisplayBlock, Void: true},
+	Html:       {Display: DisplayBlock, OptionalEnd: true},
+	Iframe:     {RawText: true},
+	Img:        {Void: true},
+	Input:      {Void: true},
+	Keygen:     {Void: true},
+	Legend:     {Display: DisplayBlock, Parents: []Atom{Fieldset}},
+	Li:         {Display: DisplayListItem, OptionalEnd: true, Parents: []Atom{Ol, Ul, Menu}},
+	Link:       {Display: DisplayNone, Void: true},
+	Listing:    {Display: DisplayBlock, PreserveSpace: true},
+	Main:       {Display: DisplayBlock},
+	Menu:       {Display: DisplayBlock},
+	Meta:       {Display: DisplayNone, Void: true},
+	Nav:        {Display: DisplayBlock},
+	Noembed:    {Display: DisplayNone, RawText: true},
+	Noframes:   {Display: DisplayNone, RawText: true},
+	Noscript:   {RawText: true},
+	Ol:         {Display: DisplayBlock},
+	Optgroup:   {Display: DisplayBlock, OptionalEnd: true, Parents: []Atom{Select}},
+	Option:     {Display: DisplayBlock, OptionalEnd: true, Parents: []Atom{Select, Datalist, Optgroup}},
+	P:          {Display: DisplayBlock, OptionalEnd: true},
+	Param:      {Display: DisplayNone, Parents: []Atom{Object}, Void: true},
+	Plaintext:  {Display: DisplayBlock, PreserveSpace: true, RawText: true},
+	Pre:        {Display: DisplayBlock, PreserveSpace: true},
+	Rb:         {OptionalEnd: true, Parents: []Atom{Ruby}},
+	Rp:         {Display: DisplayNone, OptionalEnd: true, Parents: []Atom{Ruby, Rtc}},
+	Rt:         {OptionalEnd: true, Parents: []Atom{Ruby, Rtc}},
+	Rtc:        {OptionalEnd: true, Parents: []Atom{Ruby}},
+	Script:     {Display: DisplayNone, RawText: true},
+	Section:    {Display: DisplayBlock},
+	Source:     {Parents: []Atom{Audio, Video, Picture}, Void: true},
+	Style:      {Display: DisplayNone, RawText: true},
+	Summary:    {Display: DisplayBlock, Parents: []Atom{Details}},
+	Table:      {Display: DisplayTable},
+	Tbody:      {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Table}},
+	Td:         {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Tr}},
+	Template:   {Display: DisplayNone},
+	Textarea:   {EscapableRawText: true, PreserveSpace: true},
+	Tfoot:      {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Table}},
+	Th:         {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Tr}},
+	Thead:      {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Table}},
+	Title:      {Display: DisplayNone, EscapableRawText: true},
+	Tr:         {Display: DisplayTable, OptionalEnd: true, Parents: []Atom{Table, Thead, Tbody, Tfoot}},
+	Track:      {Parents: []Atom{Audio, Video}, Void: true},
+	Ul:         {Display: DisplayBlock},
+	Wbr:        {Void: true},
+	Xmp:        {Display: DisplayBlock, PreserveSpace: true, RawText: true},
+}
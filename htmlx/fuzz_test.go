@@ -0,0 +1,79 @@
+package htmlx
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fuzzSeeds returns the documents in testdata. The .dat files hold
+// many documents each, in their #data sections.
+func fuzzSeeds(t testing.TB) [][]byte {
+	files, err := filepath.Glob(filepath.Join("testdata", "*", "*.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, filepath.Join("testdata", "go1.html"))
+
+	var seeds [][]byte
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, ".dat") {
+			seeds = append(seeds, b)
+			continue
+		}
+		for _, section := range bytes.Split(b, []byte("#data\n"))[1:] {
+			if i := bytes.Index(section, []byte("\n#errors")); i >= 0 {
+				seeds = append(seeds, section[:i])
+			}
+		}
+	}
+	for _, tt := range tokenTests {
+		seeds = append(seeds, []byte(tt.html))
+	}
+	return seeds
+}
+
+func FuzzTokenizer(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		z := NewTokenizer(bytes.NewReader(src))
+		var all []byte
+		line, column := 0, 0
+		for {
+			tt := z.Next()
+			raw := append([]byte(nil), z.Raw()...)
+			tok := z.Token()
+			if tok.Line != line || tok.Column != column {
+				t.Fatalf("%s token %q is at %d:%d, want %d:%d", tt, raw, tok.Line, tok.Column, line, column)
+			}
+			for _, c := range raw {
+				if c == '\n' {
+					line++
+					column = 0
+				} else {
+					column++
+				}
+			}
+			all = append(all, raw...)
+			if tt == ErrorToken {
+				// a tag that is cut off is still in the raw data.
+				if err := z.Err(); err != io.EOF {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				break
+			}
+		}
+		if !bytes.Equal(all, src) {
+			t.Fatalf("raw data is %q, want %q", all, src)
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package htmlx
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// A NodeType is the type of a Node.
+type NodeType uint32
+
+const (
+	ErrorNode NodeType = iota
+	TextNode
+	DocumentNode
+	ElementNode
+	CommentNode
+	DoctypeNode
+)
+
+// A Node is a node of a tree built by ParseTree. Unlike the nodes of an
+// HTML5 parse tree, the tree only has the elements that the source has,
+// and they are kept the way they are written, so that the tree can be
+// written back out unchanged.
+type Node struct {
+	Parent, FirstChild, LastChild, PrevSibling, NextSibling *Node
+
+	Type     NodeType
+	DataAtom atom.Atom
+	// Data, Prefix, Local and Attr are as they are in a Token,
+	// with the case of names kept.
+	Data          string
+	Prefix, Local string
+	Attr          []Attribute
+	// Raw is the start tag of an element, or all of any other node,
+	// as it is written. RawAttr are an element's attributes as they
+	// are written.
+	Raw     []byte
+	RawAttr []RawAttribute
+	// End is the end tag of an element. It is nil for
+	// self-closing elements.
+	End []byte
+	// Pos is where the node starts.
+	Pos srcmap.Position
+}
+
+// AppendChild adds c as the last child of n. It panics
+// if c already has a parent or siblings.
+func (n *Node) AppendChild(c *Node) {
+	if c.Parent != nil || c.PrevSibling != nil || c.NextSibling != nil {
+		panic("htmlx: AppendChild called for an attached child Node")
+	}
+	last := n.LastChild
+	if last != nil {
+		last.NextSibling = c
+	} else {
+		n.FirstChild = c
+	}
+	n.LastChild = c
+	c.Parent = n
+	c.PrevSibling = last
+}
+
+// ParseTree builds the tree of the document in r. It returns a
+// DocumentNode whose children are the document's top-level nodes.
+// Every element must be closed by a matching end tag, or be
+// self-closing, as a Structure checks.
+func ParseTree(r io.Reader) (*Node, error) {
+	z := NewTokenizer(r)
+	z.PreserveCase(true)
+	doc := &Node{Type: DocumentNode}
+	cur := doc
+	var s Structure
+	offset := 0
+	for {
+		tt := z.Next()
+		raw := append([]byte(nil), z.RawData()...)
+		rawAttr := z.RawAttrs()
+		tok := z.Token()
+		if tt == ErrorToken {
+			switch {
+			case z.Err() != io.EOF:
+				return nil, &SyntaxError{Msg: z.Err().Error(), Pos: TokenPosition(&tok, offset)}
+			case len(raw) > 0:
+				return nil, &SyntaxError{Msg: "unexpected end of file in a tag", Pos: TokenPosition(&tok, offset)}
+			}
+			if err := s.End(); err != nil {
+				return nil, err
+			}
+			return doc, nil
+		}
+
+		n := &Node{
+			DataAtom: tok.DataAtom,
+			Data:     tok.Data,
+			Prefix:   tok.Prefix,
+			Local:    tok.Local,
+			Attr:     tok.Attr,
+			Raw:      raw,
+			RawAttr:  rawAttr,
+			Pos:      TokenPosition(&tok, offset),
+		}
+		switch tt {
+		case StartTagToken:
+			n.Type = ElementNode
+			cur.AppendChild(n)
+			s.Open(&tok, offset)
+			cur = n
+		case SelfClosingTagToken:
+			n.Type = ElementNode
+			cur.AppendChild(n)
+		case EndTagToken:
+			if err := s.Close(&tok, offset); err != nil {
+				return nil, err
+			}
+			cur.End = raw
+			cur = cur.Parent
+		case TextToken:
+			n.Type = TextNode
+			cur.AppendChild(n)
+		case CommentToken:
+			n.Type = CommentNode
+			cur.AppendChild(n)
+		case DoctypeToken:
+			n.Type = DoctypeNode
+			cur.AppendChild(n)
+		}
+		offset += len(raw)
+	}
+}
+
+// RenderTree writes out the tree n, or the node if it isn't
+// a DocumentNode, the way it was written.
+func RenderTree(w io.Writer, n *Node) error {
+	var buf bytes.Buffer
+	renderNode(&buf, n)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func renderNode(buf *bytes.Buffer, n *Node) {
+	buf.Write(n.Raw)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		renderNode(buf, c)
+	}
+	buf.Write(n.End)
+}
@@ -0,0 +1,79 @@
+package htmlx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+func TestParseTree(t *testing.T) {
+	src := "<!DOCTYPE html>\n<main:MyButton :DataSource='x'>\n  <p>a<br />b<img/></p>\n  <!-- c -->\n</main:mybutton>\n"
+	doc, err := ParseTree(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderTree(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != src {
+		t.Errorf("RenderTree gave %q, want %q", buf.String(), src)
+	}
+
+	var got []string
+	var walk func(n *Node, depth int)
+	walk = func(n *Node, depth int) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Parent != n {
+				t.Errorf("%q has the wrong parent", c.Raw)
+			}
+			if c.Type != TextNode {
+				got = append(got, strings.Repeat(" ", depth)+string(c.Raw)+string(c.End))
+			}
+			walk(c, depth+1)
+		}
+	}
+	walk(doc, 0)
+	want := []string{
+		"<!DOCTYPE html>",
+		"<main:MyButton :DataSource='x'></main:mybutton>",
+		" <p></p>",
+		"  <br />",
+		"  <img/>",
+		" <!-- c -->",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got tree\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	comp := doc.FirstChild.NextSibling.NextSibling
+	if comp.Prefix != "main" || comp.Local != "MyButton" || comp.RawAttr[0].Key != ":DataSource" {
+		t.Errorf("got element %+v", comp)
+	}
+	if want := (srcmap.Position{Offset: 16, Line: 2, Column: 1}); comp.Pos != want {
+		t.Errorf("element is at %+v, want %+v", comp.Pos, want)
+	}
+}
+
+func TestParseTreeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+		kind      SyntaxErrorKind
+		offset    int
+	}{
+		{"</div>", "1:1: unexpected ending tag </div>", SyntaxStrayEndTag, 0},
+		{"<div>\n<p></div>", "2:4: mismatched ending tag (expected </p> for the <p> opened at 2:1, found </div>)", SyntaxMismatchedEndTag, 9},
+		{"<div>\n  <p>", "2:3: missing end tags: unclosed <p> opened at 2:3, unclosed <div> opened at 1:1", SyntaxUnclosedTag, 8},
+		{"<p>a<br></p>", "1:9: mismatched ending tag (expected </br> for the <br> opened at 1:5, found </p>)", SyntaxMismatchedEndTag, 8},
+		{"<div></div><p class", "1:12: unexpected end of file in a tag", SyntaxInvalid, 11},
+	} {
+		_, err := ParseTree(strings.NewReader(tc.src))
+		serr, ok := err.(*SyntaxError)
+		if !ok || err.Error() != tc.want || serr.Kind != tc.kind || serr.Pos.Offset != tc.offset {
+			t.Errorf("ParseTree(%q) = %#v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package htmlx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// A SyntaxErrorKind says what is wrong with a document.
+type SyntaxErrorKind int
+
+const (
+	// SyntaxInvalid is markup that can't be read, like a tag
+	// that the document ends in the middle of.
+	SyntaxInvalid SyntaxErrorKind = iota
+	// SyntaxStrayEndTag is an end tag that doesn't close anything.
+	SyntaxStrayEndTag
+	// SyntaxMismatchedEndTag is an end tag that doesn't close
+	// the element that was opened last.
+	SyntaxMismatchedEndTag
+	// SyntaxUnclosedTag is an element that is never closed.
+	SyntaxUnclosedTag
+)
+
+// A SyntaxError is a problem with a document, like an end tag
+// that doesn't match its start tag.
+type SyntaxError struct {
+	Msg  string
+	Kind SyntaxErrorKind
+	// Pos is where the problem is. Its Line and Column count from 1.
+	Pos srcmap.Position
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg)
+}
+
+// TokenPosition is where tok is, if it starts offset bytes
+// into the document. Unlike tok's, its Line and Column
+// count from 1.
+func TokenPosition(tok *Token, offset int) srcmap.Position {
+	return srcmap.Position{Offset: offset, Line: tok.Line + 1, Column: tok.Column + 1}
+}
+
+// A Structure checks that every element of a document is closed by a
+// matching end tag, as the document's tags are given to it in order.
+// Void elements like <br> are no exception: they have to be written
+// as self-closing tags, like <br />, which aren't given to it.
+type Structure struct {
+	open []openTag
+}
+
+type openTag struct {
+	tok *Token
+	pos srcmap.Position
+}
+
+// Open records tok, a start tag that starts offset
+// bytes into the document.
+func (s *Structure) Open(tok *Token, offset int) {
+	s.open = append(s.open, openTag{tok, TokenPosition(tok, offset)})
+}
+
+// Close records tok, an end tag that starts offset bytes into
+// the document. It is an error if tok doesn't close the element
+// that was opened last.
+func (s *Structure) Close(tok *Token, offset int) *SyntaxError {
+	top := s.Top()
+	if top == nil {
+		return &SyntaxError{
+			Msg:  fmt.Sprintf("unexpected ending tag </%s>", tok.Data),
+			Kind: SyntaxStrayEndTag,
+			Pos:  TokenPosition(tok, offset),
+		}
+	}
+	if !strings.EqualFold(top.Data, tok.Data) {
+		return &SyntaxError{
+			Msg: fmt.Sprintf("mismatched ending tag (expected </%s> for the <%s> opened at %s, found </%s>)",
+				top.Data, top.Data, lineColumn(s.open[len(s.open)-1].pos), tok.Data),
+			Kind: SyntaxMismatchedEndTag,
+			Pos:  TokenPosition(tok, offset),
+		}
+	}
+	s.open = s.open[:len(s.open)-1]
+	return nil
+}
+
+// End is called at the end of the document. It is an error,
+// reported at the innermost one, if any elements are still open.
+func (s *Structure) End() *SyntaxError {
+	if len(s.open) == 0 {
+		return nil
+	}
+	open := make([]string, 0, len(s.open))
+	for i := len(s.open) - 1; i >= 0; i-- {
+		open = append(open, fmt.Sprintf("unclosed <%s> opened at %s", s.open[i].tok.Data, lineColumn(s.open[i].pos)))
+	}
+	return &SyntaxError{
+		Msg:  "missing end tags: " + strings.Join(open, ", "),
+		Kind: SyntaxUnclosedTag,
+		Pos:  s.open[len(s.open)-1].pos,
+	}
+}
+
+// Top returns the start tag of the innermost open
+// element, or nil if there isn't one.
+func (s *Structure) Top() *Token {
+	if len(s.open) == 0 {
+		return nil
+	}
+	return s.open[len(s.open)-1].tok
+}
+
+// Depth returns how many elements are open.
+func (s *Structure) Depth() int {
+	return len(s.open)
+}
+
+func lineColumn(p srcmap.Position) string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
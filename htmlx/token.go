@@ -11,7 +11,7 @@ import (
 	"strconv"
 	"strings"
 
-	"golang.org/x/net/html/atom"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
 )
 
 // A TokenType is the type of a Token.
@@ -68,18 +68,34 @@ type Attribute struct {
 	Namespace, Key, Val string
 }
 
+// A RawAttribute is an attribute as it is written in the source. Unlike
+// Attribute, Key keeps its original case and Val is not unescaped.
+type RawAttribute struct {
+	Key, Val string
+	// Quote is the quote character around Val, or 0 if Val is unquoted
+	// or the attribute has no value.
+	Quote byte
+	// HasVal is whether the attribute has a value at all, as in
+	// `disabled=""` but not `disabled`.
+	HasVal bool
+}
+
 // A Token consists of a TokenType and some Data (tag name for start and end
 // tags, content for text, comments and doctypes). A tag Token may also contain
 // a slice of Attributes. Data is unescaped for all Tokens (it looks like "a<b"
-// rather than "a&lt;b"). For tag Tokens, DataAtom is the atom for Data, or
-// zero if Data is not a known tag name.
+// rather than "a&lt;b"). For tag Tokens, DataAtom is the atom for Data, in
+// lower case, or zero if Data is not a known tag name.
 type Token struct {
 	Type     TokenType
 	DataAtom atom.Atom
 	Data     string
-	Attr     []Attribute
-	Column   int
-	Line     int
+	// Prefix and Local are the parts of a tag Token's Data before and
+	// after a colon, as in the Vugu component tag <main:MyButton>. If
+	// there isn't a colon, Prefix is empty and Local is all of Data.
+	Prefix, Local string
+	Attr          []Attribute
+	Column        int
+	Line          int
 }
 
 // tagString returns a string representation of a tag Token's Data and Attr.
@@ -171,13 +187,15 @@ type Tokenizer struct {
 	convertNUL bool
 	// allowCDATA is whether CDATA sections are allowed in the current context.
 	allowCDATA bool
+	// preserveCase is whether tag names and attribute keys keep their case.
+	preserveCase bool
 	// tokenLine is the line that tt is found on.
 	tokenLine int
 	// tokenColumn is the column that tt starts on.
 	tokenColumn int
-	// currentLine is the ongoing temporary variable for tracking lines.
+	// currentLine is the line that the next token starts on.
 	currentLine int
-	// currentColumn is the ongoing temporary variable for tracking columns.
+	// currentColumn is the column that the next token starts on.
 	currentColumn int
 }
 
@@ -204,6 +222,15 @@ func (z *Tokenizer) AllowCDATA(allowCDATA bool) {
 	z.allowCDATA = allowCDATA
 }
 
+// PreserveCase sets whether tag names and attribute keys keep the case they
+// are written in, rather than being lower-cased, in Token, TagName and
+// TagAttr. Vugu component tags like <main:MyButton>, and props like
+// :DataSource, are case sensitive. A Token's DataAtom is still found from
+// its lower-cased name, so that <DIV> is a div either way.
+func (z *Tokenizer) PreserveCase(preserveCase bool) {
+	z.preserveCase = preserveCase
+}
+
 // NextIsNotRawText instructs the tokenizer that the next token should not be
 // considered as 'raw text'. Some elements, such as script and title elements,
 // normally require the next token after the opening tag to be 'raw text' that
@@ -299,14 +326,6 @@ func (z *Tokenizer) readByte() byte {
 		return 0
 	}
 
-	// Increment the line and column tracker
-	if x == '\n' {
-		z.currentLine++
-		z.currentColumn = 0
-	} else {
-		z.currentColumn++
-	}
-
 	return x
 }
 
@@ -775,28 +794,6 @@ func (z *Tokenizer) readCDATA() bool {
 	}
 }
 
-// startTagIn returns whether the start tag in z.buf[z.data.start:z.data.end]
-// case-insensitively matches any element of ss.
-func (z *Tokenizer) startTagIn(ss ...string) bool {
-loop:
-	for _, s := range ss {
-		if z.data.end-z.data.start != len(s) {
-			continue loop
-		}
-		for i := 0; i < len(s); i++ {
-			c := z.buf[z.data.start+i]
-			if 'A' <= c && c <= 'Z' {
-				c += 'a' - 'A'
-			}
-			if c != s[i] {
-				continue loop
-			}
-		}
-		return true
-	}
-	return false
-}
-
 // readStartTag reads the next start tag token. The opening "<a" has already
 // been consumed, where 'a' means anything in [A-Za-z].
 func (z *Tokenizer) readStartTag() TokenType {
@@ -805,26 +802,8 @@ func (z *Tokenizer) readStartTag() TokenType {
 		return ErrorToken
 	}
 	// Several tags flag the tokenizer's next token as raw.
-	c, raw := z.buf[z.data.start], false
-	if 'A' <= c && c <= 'Z' {
-		c += 'a' - 'A'
-	}
-	switch c {
-	case 'i':
-		raw = z.startTagIn("iframe")
-	case 'n':
-		raw = z.startTagIn("noembed", "noframes", "noscript")
-	case 'p':
-		raw = z.startTagIn("plaintext")
-	case 's':
-		raw = z.startTagIn("script", "style")
-	case 't':
-		raw = z.startTagIn("textarea", "title")
-	case 'x':
-		raw = z.startTagIn("xmp")
-	}
-	if raw {
-		z.rawTag = strings.ToLower(string(z.buf[z.data.start:z.data.end]))
+	if name := z.buf[z.data.start:z.data.end]; rawTag(lookupLower(name)) {
+		z.rawTag = strings.ToLower(string(name))
 	}
 	// Look for a self-closing token like "<br/>".
 	if z.err == nil && z.buf[z.raw.end-2] == '/' {
@@ -900,7 +879,14 @@ func (z *Tokenizer) readTagAttrKey() {
 		case ' ', '\n', '\r', '\t', '\f', '/':
 			z.pendingAttr[0].end = z.raw.end - 1
 			return
-		case '=', '>':
+		case '=':
+			if z.pendingAttr[0].start+1 == z.raw.end {
+				// WHATWG 13.2.5.32, if we see an equals sign before the attribute name
+				// begins, we treat it as a character in the attribute name and continue.
+				continue
+			}
+			fallthrough
+		case '>':
 			z.raw.end--
 			z.pendingAttr[0].end = z.raw.end
 			return
@@ -974,7 +960,22 @@ func (z *Tokenizer) readTagAttrVal() {
 func (z *Tokenizer) Next() TokenType {
 	z.tokenLine = z.currentLine
 	z.tokenColumn = z.currentColumn
+	z.next()
+	// The scanner reads ahead and backs up again, so positions are
+	// only tracked once the token's raw data is known.
+	for _, c := range z.buf[z.raw.start:z.raw.end] {
+		if c == '\n' {
+			z.currentLine++
+			z.currentColumn = 0
+		} else {
+			z.currentColumn++
+		}
+	}
+	return z.tt
+}
 
+// next does the work of Next, apart from tracking positions.
+func (z *Tokenizer) next() TokenType {
 	z.raw.start = z.raw.end
 	z.data.start = z.raw.end
 	z.data.end = z.raw.end
@@ -1157,7 +1158,8 @@ func (z *Tokenizer) Text() []byte {
 }
 
 // TagName returns the lower-cased name of a tag token (the `img` out of
-// `<IMG SRC="foo">`) and whether the tag has attributes.
+// `<IMG SRC="foo">`), or the name as it is written if PreserveCase is set,
+// and whether the tag has attributes.
 // The contents of the returned slice may change on the next call to Next.
 func (z *Tokenizer) TagName() (name []byte, hasAttr bool) {
 	if z.data.start < z.data.end {
@@ -1166,14 +1168,46 @@ func (z *Tokenizer) TagName() (name []byte, hasAttr bool) {
 			s := z.buf[z.data.start:z.data.end]
 			z.data.start = z.raw.end
 			z.data.end = z.raw.end
-			return lower(s), z.nAttrReturned < len(z.attr)
+			if !z.preserveCase {
+				s = lower(s)
+			}
+			return s, z.nAttrReturned < len(z.attr)
 		}
 	}
 	return nil, false
 }
 
-// TagAttr returns the lower-cased key and unescaped value of the next unparsed
-// attribute for the current tag token and whether there are more attributes.
+// RawAttrs returns the attributes of the current tag token as they are
+// written in the source. It doesn't consume them, but it must be called
+// before Token, TagName or TagAttr, since those rewrite the buffer in place.
+func (z *Tokenizer) RawAttrs() []RawAttribute {
+	switch z.tt {
+	case StartTagToken, SelfClosingTagToken:
+	default:
+		return nil
+	}
+	attrs := make([]RawAttribute, len(z.attr))
+	for i, x := range z.attr {
+		a := RawAttribute{
+			Key: string(z.buf[x[0].start:x[0].end]),
+			Val: string(z.buf[x[1].start:x[1].end]),
+		}
+		if x[1].start > x[0].end {
+			a.HasVal = bytes.IndexByte(z.buf[x[0].end:x[1].start], '=') >= 0
+		}
+		if a.HasVal {
+			if q := z.buf[x[1].start-1]; q == '"' || q == '\'' {
+				a.Quote = q
+			}
+		}
+		attrs[i] = a
+	}
+	return attrs
+}
+
+// TagAttr returns the lower-cased key, or the key as it is written if
+// PreserveCase is set, and unescaped value of the next unparsed attribute
+// for the current tag token and whether there are more attributes.
 // The contents of the returned slices may change on the next call to Next.
 func (z *Tokenizer) TagAttr() (key, val []byte, moreAttr bool) {
 	if z.nAttrReturned < len(z.attr) {
@@ -1183,7 +1217,10 @@ func (z *Tokenizer) TagAttr() (key, val []byte, moreAttr bool) {
 			z.nAttrReturned++
 			key = z.buf[x[0].start:x[0].end]
 			val = z.buf[x[1].start:x[1].end]
-			return lower(key), unescape(convertNewlines(val), true), z.nAttrReturned < len(z.attr)
+			if !z.preserveCase {
+				key = lower(key)
+			}
+			return key, unescape(convertNewlines(val), true), z.nAttrReturned < len(z.attr)
 		}
 	}
 	return nil, nil, false
@@ -1203,16 +1240,32 @@ func (z *Tokenizer) Token() Token {
 			key, val, moreAttr = z.TagAttr()
 			t.Attr = append(t.Attr, Attribute{"", atom.String(key), string(val)})
 		}
-		t.Data = string(name)
-		if a := atom.Lookup(name); a != 0 {
-			t.DataAtom, t.Data = a, a.String()
+		t.DataAtom = lookupLower(name)
+		if t.DataAtom != 0 && !z.preserveCase {
+			t.Data = t.DataAtom.String()
 		} else {
-			t.DataAtom, t.Data = 0, string(name)
+			t.Data = string(name)
+		}
+		t.Local = t.Data
+		if i := strings.IndexByte(t.Data, ':'); i >= 0 {
+			t.Prefix, t.Local = t.Data[:i], t.Data[i+1:]
 		}
 	}
 	return t
 }
 
+// lookupLower returns the atom for name, lower-cased, without changing name.
+func lookupLower(name []byte) atom.Atom {
+	var buf [32]byte
+	if len(name) > len(buf) {
+		// no atom is that long.
+		return 0
+	}
+	b := buf[:len(name)]
+	copy(b, name)
+	return atom.Lookup(lower(b))
+}
+
 // SetMaxBuf sets a limit on the amount of data buffered during tokenization.
 // A value of 0 means unlimited.
 func (z *Tokenizer) SetMaxBuf(n int) {
@@ -1239,10 +1292,16 @@ func NewTokenizerFragment(r io.Reader, contextTag string) *Tokenizer {
 		buf: make([]byte, 0, 4096),
 	}
 	if contextTag != "" {
-		switch s := strings.ToLower(contextTag); s {
-		case "iframe", "noembed", "noframes", "noscript", "plaintext", "script", "style", "title", "textarea", "xmp":
+		if s := strings.ToLower(contextTag); rawTag(atom.Lookup([]byte(s))) {
 			z.rawTag = s
 		}
 	}
 	return z
 }
+
+// rawTag reports whether the contents of the element a are
+// read as text, up to its end tag.
+func rawTag(a atom.Atom) bool {
+	info := atom.Info(a)
+	return info.RawText || info.EscapableRawText
+}
@@ -6,6 +6,7 @@ package htmlx
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"reflect"
@@ -448,6 +449,16 @@ var tokenTests = []tokenTest{
 		`<p id=can't><p id=won't>`,
 		`<p id="can&#39;t">$<p id="won&#39;t">`,
 	},
+	{
+		"Attributes with an equals sign first",
+		`<p =a>`,
+		`<p =a="">`,
+	},
+	{
+		"Attributes with an equals sign first, then a self-closing slash",
+		`<a b=c =/>`,
+		`<a b="c" ==""/>`,
+	},
 }
 
 func TestTokenizer(t *testing.T) {
@@ -584,6 +595,61 @@ loop:
 	}
 }
 
+func TestRawAttrs(t *testing.T) {
+	z := NewTokenizer(strings.NewReader(`<My-Comp Vg-If='a &amp;&amp; b' class="x" d=y e f="">`))
+	z.Next()
+	want := []RawAttribute{
+		{Key: "Vg-If", Val: "a &amp;&amp; b", Quote: '\'', HasVal: true},
+		{Key: "class", Val: "x", Quote: '"', HasVal: true},
+		{Key: "d", Val: "y", HasVal: true},
+		{Key: "e"},
+		{Key: "f", Quote: '"', HasVal: true},
+	}
+	if got := z.RawAttrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if tok := z.Token(); tok.Attr[0].Key != "vg-if" || tok.Attr[0].Val != "a && b" {
+		t.Errorf("Token attributes: %+v", tok.Attr)
+	}
+}
+
+func TestPreserveCase(t *testing.T) {
+	src := `<main:MyButton :DataSource="x" Class=y><DIV></DIV><Script>a</SCRIPT></main:MyButton>`
+	var got []string
+	z := NewTokenizer(strings.NewReader(src))
+	z.PreserveCase(true)
+	for z.Next() != ErrorToken {
+		tok := z.Token()
+		s := fmt.Sprintf("%s %q %q %q", tok.Type, tok.Data, tok.Prefix, tok.Local)
+		if tok.DataAtom != 0 {
+			s += " " + tok.DataAtom.String()
+		}
+		for _, a := range tok.Attr {
+			s += " " + a.Key
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		`StartTag "main:MyButton" "main" "MyButton" :DataSource Class`,
+		`StartTag "DIV" "" "DIV" div`,
+		`EndTag "DIV" "" "DIV" div`,
+		`StartTag "Script" "" "Script" script`,
+		`Text "a" "" ""`,
+		`EndTag "SCRIPT" "" "SCRIPT" script`,
+		`EndTag "main:MyButton" "main" "MyButton"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// without it, names are lower-cased, and the prefix is still split off.
+	z = NewTokenizer(strings.NewReader(src))
+	z.Next()
+	if tok := z.Token(); tok.Data != "main:mybutton" || tok.Prefix != "main" || tok.Local != "mybutton" || tok.Attr[0].Key != ":datasource" {
+		t.Errorf("got %+v", tok)
+	}
+}
+
 func TestConvertNewlines(t *testing.T) {
 	testCases := map[string]string{
 		"Mac\rDOS\r\nUnix\n":    "Mac\nDOS\nUnix\n",
@@ -746,3 +812,16 @@ func benchmarkTokenizer(b *testing.B, level int) {
 func BenchmarkRawLevelTokenizer(b *testing.B)  { benchmarkTokenizer(b, rawLevel) }
 func BenchmarkLowLevelTokenizer(b *testing.B)  { benchmarkTokenizer(b, lowLevel) }
 func BenchmarkHighLevelTokenizer(b *testing.B) { benchmarkTokenizer(b, highLevel) }
+
+func TestTokenPositions(t *testing.T) {
+	// the tokenizer reads past the end of text before backing up.
+	z := NewTokenizer(strings.NewReader("ab\ncd<p>e</p>"))
+	var got []string
+	for z.Next() != ErrorToken {
+		tok := z.Token()
+		got = append(got, fmt.Sprintf("%d:%d", tok.Line, tok.Column))
+	}
+	if want := "0:0 1:2 1:5 1:6"; strings.Join(got, " ") != want {
+		t.Errorf("got positions %s, want %s", strings.Join(got, " "), want)
+	}
+}
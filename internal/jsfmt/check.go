@@ -0,0 +1,115 @@
+package jsfmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ChangeError is returned instead of a formatted script whose tokens
+// aren't those of the original, apart from the semicolons that were
+// written out and how strings are quoted. It means the script has
+// syntax that the formatter gets wrong, so it's better left alone.
+type ChangeError struct {
+	// Line and Column are where the first difference is in the
+	// original script. They are 0 if it isn't known.
+	Line, Column int
+}
+
+func (e *ChangeError) Error() string {
+	if e.Line == 0 {
+		return "formatting would change the script"
+	}
+	return fmt.Sprintf("%d:%d: formatting would change the script here", e.Line, e.Column)
+}
+
+// Compare checks that res, a formatted version of the script src, has
+// the same tokens, apart from semicolons and quotes. The error is a
+// *ChangeError at the first difference in res, or a *SyntaxError if
+// either can't be read. Scripts that can't be read are only the same
+// if they're identical.
+func Compare(src, res []byte) error {
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	in, err := lex(src)
+	if err != nil {
+		return err
+	}
+	out, err := lex(res)
+	if err != nil {
+		return err
+	}
+	if _, j, ok := compare(in, out); !ok {
+		return changeAt(out, j)
+	}
+	return nil
+}
+
+// check reads res, the formatted script, back in and compares its tokens
+// with toks, the script's.
+func check(toks []token, res []byte) error {
+	out, err := lex(res)
+	if err != nil {
+		return &ChangeError{}
+	}
+	if i, _, ok := compare(toks, out); !ok {
+		return changeAt(toks, i)
+	}
+	return nil
+}
+
+// compare reports whether out are the tokens of in, formatted. If
+// they aren't, i and j are where they start to differ. Line breaks
+// between tokens have to be kept too, since they can end statements.
+func compare(in, out []token) (i, j int, ok bool) {
+	for ; j < len(out); j++ {
+		if i < len(in) && sameToken(&in[i], &out[j]) && (in[i].newlines > 0) == (out[j].newlines > 0) {
+			i++
+			continue
+		}
+		if out[j].is(";") {
+			// one that JavaScript would have inserted.
+			continue
+		}
+		return i, j, false
+	}
+	return i, j, i == len(in)
+}
+
+// changeAt is the error for a difference at toks[i], or
+// at the end of toks.
+func changeAt(toks []token, i int) *ChangeError {
+	if i >= len(toks) {
+		i = len(toks) - 1
+	}
+	if i < 0 {
+		return &ChangeError{}
+	}
+	return &ChangeError{Line: toks[i].line, Column: toks[i].column}
+}
+
+// sameToken reports whether out is t, formatted.
+func sameToken(t, out *token) bool {
+	if t.kind != out.kind {
+		return false
+	}
+	switch t.kind {
+	case stringToken:
+		return requote(t.text) == out.text
+	case lineCommentToken:
+		return strings.TrimRight(t.text, " \t\r") == out.text
+	case blockCommentToken:
+		return trimLines(t.text) == trimLines(out.text)
+	}
+	return t.text == out.text
+}
+
+// trimLines takes the space off the ends of the lines of s.
+func trimLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,631 @@
+// Package jsfmt formats JavaScript.
+//
+// It doesn't build a syntax tree. The formatter goes through the tokens
+// of a script, keeping track of the brackets that are open and of where
+// statements start, which is enough to indent each line by how deeply it
+// is nested, to space the tokens of a line out evenly, to put in the
+// semicolons that JavaScript would insert, and to quote strings the same
+// way. Line breaks and comments are kept where they are.
+//
+// Since that can go wrong for syntax it doesn't expect, the result is
+// read back in, and it is only used if it has the same tokens as the
+// script, apart from semicolons and quotes.
+//
+// Without a syntax tree, the only syntax errors it finds are in tokens,
+// like strings that aren't terminated, and brackets that don't match.
+// Anything else, like let = = 3, is formatted as if it were valid.
+package jsfmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type contextKind int
+
+const (
+	topContext contextKind = iota
+	// blockContext is a { } that has statements in it,
+	// like the body of a function.
+	blockContext
+	objectContext
+	classContext
+	parenContext
+	bracketContext
+)
+
+// context is a bracket that is open, or the top level of the script.
+type context struct {
+	kind contextKind
+	open *token
+	// level is the indentation of the line the bracket is on.
+	level int
+	// atStart is whether the bracket started a statement, like
+	// the body of an if does, rather than being in an expression.
+	atStart bool
+	// header is the ( ) of a statement like if (...).
+	header bool
+	// ternaries is how many ? haven't been matched with a : yet.
+	ternaries int
+
+	// The rest is about the statement being formatted, in the top
+	// level or a block. start is set until the statement's first
+	// token, and control is set for statements like if and while,
+	// whose end isn't a semicolon. awaitHeader is set until their
+	// ( ) is seen. label is set for labels until their :, and
+	// caseLabel if it's a case label. inCase is set for the
+	// statements after a case label.
+	start       bool
+	control     bool
+	awaitHeader bool
+	label       bool
+	caseLabel   bool
+	inCase      bool
+	// doLoop is set from a do to its while.
+	doLoop bool
+}
+
+func (c *context) statements() bool {
+	return c.kind == topContext || c.kind == blockContext
+}
+
+// endStatement notes that the statement in c is done.
+func (c *context) endStatement() {
+	c.start = true
+	c.control = false
+	c.awaitHeader = false
+	c.label = false
+	c.caseLabel = false
+}
+
+// line is a line of output.
+type line struct {
+	level int
+	text  []byte
+}
+
+type printer struct {
+	toks   []token
+	indent string
+	stack  []*context
+	lines  []line
+
+	// prev is the last token written, and last is the last one
+	// that isn't a comment. lastEnds is whether last can end a
+	// statement, and lastLine and lastEnd are where it ends in
+	// the output, which is where inserted semicolons go.
+	prev, last        *token
+	lastEnds          bool
+	lastLine, lastEnd int
+	// broken is set if there's a line break after last.
+	broken bool
+	// unary is set if prev is a unary operator.
+	unary bool
+	// class is set from the class keyword to the class body.
+	class bool
+	// ternaryColon is set if the token being written is the : of a ? :.
+	ternaryColon bool
+	// body is set if the token being written starts the body of
+	// a statement like if, without braces.
+	body bool
+	// property is set if prev is a name after a dot, which can be
+	// a keyword.
+	property bool
+}
+
+// Format formats the JavaScript src, indenting it with indent.
+// Whitespace before and after the script stays the same, apart
+// from there being at most one line break in it. Errors are a
+// *SyntaxError if src's tokens can't be read or its brackets don't
+// match, or a *ChangeError if formatting it would change it. Its
+// statements and expressions aren't checked.
+func Format(src []byte, indent string) ([]byte, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return src, nil
+	}
+
+	p := &printer{toks: toks, indent: indent, stack: []*context{{kind: topContext, level: -1, start: true}}}
+	for i := range toks {
+		if err := p.token(i); err != nil {
+			return nil, err
+		}
+	}
+	if top := p.top(); top.kind != topContext {
+		return nil, &SyntaxError{
+			Msg:    fmt.Sprintf("%q is never closed", top.open.text),
+			Line:   top.open.line,
+			Column: top.open.column,
+		}
+	}
+	p.insertSemicolon(nil)
+
+	var buf bytes.Buffer
+	lead := len(src) - len(bytes.TrimLeft(src, " \t\r\n\f\v"))
+	if bytes.ContainsRune(src[:lead], '\n') {
+		buf.WriteByte('\n')
+	}
+	for i, l := range p.lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		if len(l.text) > 0 {
+			buf.WriteString(strings.Repeat(indent, l.level))
+			buf.Write(l.text)
+		}
+	}
+	trimmed := bytes.TrimRight(src, " \t\r\n\f\v")
+	if bytes.ContainsRune(src[len(trimmed):], '\n') {
+		buf.WriteByte('\n')
+	}
+	if err := check(toks, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *printer) top() *context {
+	return p.stack[len(p.stack)-1]
+}
+
+// nextToken is the token after i that isn't a comment, or nil.
+func (p *printer) nextToken(i int) *token {
+	for i++; i < len(p.toks); i++ {
+		if !p.toks[i].comment() {
+			return &p.toks[i]
+		}
+	}
+	return nil
+}
+
+// token formats the token i.
+func (p *printer) token(i int) error {
+	t := &p.toks[i]
+	if t.newlines > 0 {
+		p.broken = true
+	}
+	if t.comment() {
+		p.write(t)
+		return nil
+	}
+
+	if p.last != nil && (p.broken || t.is("}")) {
+		p.insertSemicolon(t)
+	}
+	top := p.top()
+	wasStart := top.statements() && top.start
+	p.body = wasStart && top.control && !t.is("{")
+	if wasStart && !t.is("}") && !t.is(";") {
+		p.startStatement(i)
+	}
+	p.ternaryColon = t.is(":") && top.ternaries > 0
+
+	// closing brackets are written at the level of the line that
+	// opened them, so they're checked first.
+	if t.kind == punctToken && (t.text == "}" || t.text == ")" || t.text == "]") {
+		if top.kind == topContext || closer(top.open.text) != t.text {
+			return &SyntaxError{Msg: fmt.Sprintf("unexpected %q", t.text), Line: t.line, Column: t.column}
+		}
+	}
+	p.write(t)
+	ends := false
+
+	switch {
+	case t.kind == identToken:
+		ends = !keywords[t.text] || p.last.is(".") || p.last.is("?.")
+		if t.text == "class" {
+			p.class = true
+		}
+	case t.kind != punctToken:
+		ends = true
+	case t.text == "{":
+		c := &context{kind: objectContext, open: t, level: p.lines[len(p.lines)-1].level, atStart: wasStart, start: true}
+		switch {
+		case wasStart:
+			c.kind = blockContext
+		case p.class:
+			c.kind = classContext
+			p.class = false
+		case p.last.is(")") || p.last.is("=>"):
+			c.kind = blockContext
+		}
+		p.stack = append(p.stack, c)
+	case t.text == "(" || t.text == "[":
+		c := &context{kind: bracketContext, open: t, level: p.lines[len(p.lines)-1].level}
+		if t.text == "(" {
+			c.kind = parenContext
+			c.header = top.statements() && top.awaitHeader
+			top.awaitHeader = false
+		}
+		p.stack = append(p.stack, c)
+	case t.text == "}" || t.text == ")" || t.text == "]":
+		p.stack = p.stack[:len(p.stack)-1]
+		parent := p.top()
+		switch {
+		case t.text == ")" && top.header:
+			// the statement's body comes next.
+			parent.start = true
+		case t.text == "}" && top.atStart:
+			parent.endStatement()
+		case top.kind == classContext && parent.statements() && parent.control:
+			parent.endStatement()
+		default:
+			ends = true
+		}
+	case t.text == ";":
+		if top.statements() {
+			top.endStatement()
+		}
+	case t.text == "?":
+		top.ternaries++
+	case t.text == ":" && p.ternaryColon:
+		top.ternaries--
+	case t.text == ":" && top.statements() && top.label:
+		top.inCase = top.inCase || top.caseLabel
+		top.endStatement()
+	case t.text == "++" || t.text == "--":
+		ends = p.unary == false && p.lastEnds
+	}
+
+	p.last = t
+	p.lastEnds = ends
+	p.lastLine = len(p.lines) - 1
+	p.lastEnd = len(p.lines[p.lastLine].text)
+	p.broken = false
+	return nil
+}
+
+// startStatement notes what kind of statement the token i starts.
+func (p *printer) startStatement(i int) {
+	top := p.top()
+	top.start = false
+	top.control = false
+	top.awaitHeader = false
+	top.label = false
+	top.caseLabel = false
+
+	t := &p.toks[i]
+	word := ""
+	if t.kind == identToken {
+		word = t.text
+	}
+	// export and export default are followed by what's exported.
+	for j := i; word == "export" || word == "default" && j > i || word == "async"; {
+		next := p.nextToken(j)
+		if next == nil || next.kind != identToken {
+			break
+		}
+		if word == "async" && next.text != "function" {
+			break
+		}
+		j += indexAfter(p.toks[j+1:], next)
+		word = next.text
+	}
+
+	switch word {
+	case "while":
+		// the while of a do is the end of it, not a loop.
+		top.control = !top.doLoop
+		top.awaitHeader = true
+		top.doLoop = false
+	case "if", "for", "switch", "with", "catch", "function":
+		top.control = true
+		top.awaitHeader = true
+	case "class":
+		top.control = true
+	case "do", "else", "try", "finally":
+		top.control = true
+		top.start = true
+		top.doLoop = top.doLoop || word == "do"
+	case "case", "default":
+		// but not export default.
+		top.label = word == t.text
+		top.caseLabel = top.label
+	case "":
+		if t.is("{") {
+			top.control = true
+		}
+	default:
+		if next := p.nextToken(i); next.is(":") && !keywords[word] {
+			top.label = true
+		}
+	}
+}
+
+// indexAfter is how many tokens of toks there are up to and including t.
+func indexAfter(toks []token, t *token) int {
+	for i := range toks {
+		if &toks[i] == t {
+			return i + 1
+		}
+	}
+	return len(toks)
+}
+
+// insertSemicolon puts a semicolon after the last token if JavaScript
+// would insert one there, before next. next is nil at the end of the
+// script.
+func (p *printer) insertSemicolon(next *token) {
+	top := p.top()
+	if p.last == nil || !top.statements() || top.start || top.control || top.label || next.is(";") {
+		return
+	}
+	restricted := p.last.kind == identToken && restrictedKeywords[p.last.text]
+	if !restricted {
+		if !p.lastEnds {
+			return
+		}
+		if next != nil && !next.is("}") && continues(next) {
+			return
+		}
+	}
+
+	l := &p.lines[p.lastLine]
+	l.text = append(l.text[:p.lastEnd], append([]byte{';'}, l.text[p.lastEnd:]...)...)
+	semicolon := &token{kind: punctToken, text: ";"}
+	if p.lastLine == len(p.lines)-1 && p.lastEnd == len(l.text)-1 {
+		p.prev = semicolon
+	}
+	p.last = semicolon
+	p.lastEnds = false
+	top.endStatement()
+}
+
+// continues reports whether a statement can go on with t after a line
+// break, so that JavaScript doesn't insert a semicolon before it.
+func continues(t *token) bool {
+	switch t.kind {
+	case punctToken:
+		switch t.text {
+		case "{", "}", "!", "~", "++", "--", ";":
+			return false
+		}
+		return true
+	case templateToken:
+		return true
+	case identToken:
+		return t.text == "in" || t.text == "instanceof"
+	}
+	return false
+}
+
+// write adds t to the output.
+func (p *printer) write(t *token) {
+	if len(p.lines) == 0 || t.newlines > 0 {
+		if len(p.lines) > 0 && t.newlines > 1 {
+			p.lines = append(p.lines, line{})
+		}
+		p.lines = append(p.lines, line{level: p.level(t)})
+		p.prev = nil
+	}
+	l := &p.lines[len(p.lines)-1]
+
+	if p.prev != nil && p.space(p.prev, t) {
+		l.text = append(l.text, ' ')
+	}
+	switch t.kind {
+	case stringToken:
+		l.text = append(l.text, requote(t.text)...)
+	case lineCommentToken:
+		l.text = append(l.text, strings.TrimRight(t.text, " \t\r")...)
+	case blockCommentToken:
+		l.text = append(l.text, p.comment(t.text, l.level)...)
+	default:
+		l.text = append(l.text, t.text...)
+	}
+
+	if !t.comment() {
+		p.unary = false
+		if t.kind == punctToken {
+			switch t.text {
+			case "!", "~", "...":
+				p.unary = true
+			case "+", "-", "++", "--":
+				p.unary = p.last == nil || !p.lastEnds
+			}
+		}
+	}
+	if !t.comment() {
+		p.property = t.kind == identToken && (p.last.is(".") || p.last.is("?."))
+	}
+	p.prev = t
+}
+
+// level is how deeply the line that starts with t is indented.
+func (p *printer) level(t *token) int {
+	top := p.top()
+	if t.kind == punctToken && (t.text == "}" || t.text == ")" || t.text == "]") && top.kind != topContext {
+		return top.level
+	}
+	level := top.level + 1
+	if t.comment() {
+		if top.inCase {
+			level++
+		}
+		return level
+	}
+	switch {
+	case top.inCase && !t.is("case") && !t.is("default"):
+		level++
+	case p.body:
+		// the body of an if without braces.
+		level++
+	case t.kind == punctToken && p.lastEnds && continuesLine(t.text) && !prefixOnly(t.text):
+		// a = b
+		//   + c
+		level++
+	case t.is(".") || t.is("?."):
+		level++
+	case p.last != nil && p.last.kind == punctToken && !p.lastEnds && !p.unary && continuesLine(p.last.text):
+		level++
+	}
+	return level
+}
+
+// continuesLine reports whether a line that ends in the
+// punctuator s goes on on the next line, like a = b +.
+func continuesLine(s string) bool {
+	switch s {
+	case ",", ";", "{", "(", "[", ":", "}", ")", "]":
+		return false
+	}
+	return true
+}
+
+// prefixOnly reports whether the punctuator s can only
+// come before an operand.
+func prefixOnly(s string) bool {
+	return s == "!" || s == "~" || s == "..." || s == "@" || s == "++" || s == "--"
+}
+
+// space reports whether there's a space between prev and t.
+func (p *printer) space(prev, t *token) bool {
+	switch {
+	case t.kind == lineCommentToken:
+		return true
+	case prev.kind == blockCommentToken:
+		return !t.is(")") && !t.is(",") && !t.is(";") && !t.is("]")
+	case t.kind == blockCommentToken:
+		return !prev.is("(") && !prev.is("[")
+	case prev.kind == lineCommentToken:
+		return false
+	}
+
+	pt, tt := prev.text, t.text
+	pp, tp := prev.kind == punctToken, t.kind == punctToken
+	switch {
+	case tp && (tt == "," || tt == ";"):
+		return false
+	case pp && pt == ";":
+		return !(tp && (tt == ";" || tt == ")"))
+	case pp && pt == ",":
+		return true
+	case tp && (tt == ")" || tt == "]"):
+		return false
+	case pp && (pt == "(" || pt == "["):
+		return false
+	case pp && pt == "{":
+		return !(tp && tt == "}")
+	case tp && tt == "}":
+		return true
+	case tp && (tt == "." || tt == "?."), pp && (pt == "." || pt == "?." || pt == "..." || pt == "@"):
+		return false
+	case tp && tt == "(":
+		switch {
+		case prev.kind == identToken:
+			return keywords[pt] && !p.property && pt != "this" && pt != "super" && pt != "import"
+		case pp:
+			return !p.unary && pt != ")" && pt != "]"
+		}
+		return false
+	case tp && tt == "[":
+		return pp && !p.unary && pt != ")" && pt != "]" && pt != "}" || prev.kind == identToken && keywords[pt]
+	case t.kind == templateToken:
+		return !(prev.kind == identToken && !keywords[pt] || pp && pt == ")")
+	case tp && tt == ":":
+		return p.ternaryColon
+	case tp && (tt == "++" || tt == "--"):
+		return !(p.last != nil && p.lastEnds)
+	case prev.kind == identToken && pt == "function" && tp && tt == "*":
+		return false
+	case pp && p.unary:
+		return false
+	}
+	return true
+}
+
+// comment lines up the lines of a block comment that start with *,
+// like those of a doc comment, under its first line.
+func (p *printer) comment(text string, level int) string {
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+		if i == 0 {
+			continue
+		}
+		if trimmed := strings.TrimLeft(lines[i], " \t"); strings.HasPrefix(trimmed, "*") {
+			lines[i] = strings.Repeat(p.indent, level) + " " + trimmed
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// requote writes a string literal in double quotes, unless
+// it has more double quotes in it than single ones.
+func requote(s string) string {
+	quote, body := s[0], s[1:len(s)-1]
+	doubles, singles := 0, 0
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == '\\' && i+1 < len(body) {
+			i++
+			c = body[i]
+		}
+		switch c {
+		case '"':
+			doubles++
+		case '\'':
+			singles++
+		}
+	}
+	want := byte('"')
+	if doubles > singles {
+		want = '\''
+	}
+	if want == quote {
+		return s
+	}
+
+	var b strings.Builder
+	b.WriteByte(want)
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\\' && i+1 < len(body) && body[i+1] == quote:
+			// the old quote doesn't need escaping any more.
+			b.WriteByte(quote)
+			i++
+		case c == '\\' && i+1 < len(body):
+			b.WriteByte(c)
+			b.WriteByte(body[i+1])
+			i++
+		case c == want:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(want)
+	return b.String()
+}
+
+func closer(open string) string {
+	switch open {
+	case "{":
+		return "}"
+	case "(":
+		return ")"
+	}
+	return "]"
+}
+
+// keywords are the words that aren't values,
+// so that statements can't end with them.
+var keywords = map[string]bool{
+	"break": true, "case": true, "catch": true, "class": true, "const": true, "continue": true,
+	"debugger": true, "default": true, "delete": true, "do": true, "else": true, "export": true,
+	"extends": true, "finally": true, "for": true, "function": true, "if": true, "import": true,
+	"in": true, "instanceof": true, "let": true, "new": true, "return": true, "switch": true,
+	"throw": true, "try": true, "typeof": true, "var": true, "void": true, "while": true,
+	"with": true, "yield": true, "await": true, "async": true,
+}
+
+// restrictedKeywords end their statement at a line break,
+// whatever comes after them.
+var restrictedKeywords = map[string]bool{
+	"return": true, "break": true, "continue": true, "debugger": true,
+}
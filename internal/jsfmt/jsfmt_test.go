@@ -0,0 +1,120 @@
+package jsfmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"empty", "\n  \n", "\n  \n"},
+		{"surrounding space", "\n\n  a = 1  \n\n", "\na = 1;\n"},
+		{"no surrounding space", "a=1", "a = 1;"},
+		{"spacing", "let x=a+b*-c,y=[1,2],z=f(a,...b)", "let x = a + b * -c, y = [1, 2], z = f(a, ...b);"},
+		{"keywords", "if(a){return typeof(b)}", "if (a) { return typeof (b); }"},
+		{"property keywords", "p.catch(e=>{})", "p.catch(e => {});"},
+		{"member access", "a . b ?. c [0] ( 1 )", "a.b?.c[0](1);"},
+		{"ternary", "x=a?b:c\nfoo:for(;;){}", "x = a ? b : c;\nfoo: for (;;) {}"},
+		{"quotes", `a='x';b='say "hi"';c="it's";d='it\'s'`, `a = "x"; b = 'say "hi"'; c = "it's"; d = "it's";`},
+		{"regex and division", "a=b/c/d\nr=/[/]x/g.test(s)", "a = b / c / d;\nr = /[/]x/g.test(s);"},
+		{"division after parentheses", "a=(b)/c/d\nf(x)/2", "a = (b) / c / d;\nf(x) / 2;"},
+		{
+			"regex after a statement header",
+			"if (x) /re/.test(s)\nfor (const a of b) /x/.test(a)\nwhile(f(a)) /y/g.exec(s)",
+			"if (x) /re/.test(s);\nfor (const a of b) /x/.test(a);\nwhile (f(a)) /y/g.exec(s);",
+		},
+		{"regex after a block", "if (a) {\n}\n/x/.test(s)", "if (a) {\n}\n/x/.test(s);"},
+		{"do while", "do i++\nwhile (i < 3)\nf()", "do i++;\nwhile (i < 3)\nf();"},
+		{"templates", "t=`a ${ {b:1}.b } c`\nf`x`", "t = `a ${ {b:1}.b } c`;\nf`x`;"},
+		{"blank lines", "a()\n\n\n\nb()", "a();\n\nb();"},
+		{
+			"indentation",
+			"function f(a) {\nif (a) {\nreturn [\n1,\n2,\n]\n}\n}",
+			"function f(a) {\n\tif (a) {\n\t\treturn [\n\t\t\t1,\n\t\t\t2,\n\t\t];\n\t}\n}",
+		},
+		{
+			"braceless bodies",
+			"if (a)\nb()\nelse\nc()\nd()",
+			"if (a)\n\tb();\nelse\n\tc();\nd();",
+		},
+		{
+			"continued lines",
+			"x = a +\nb\ny = a\n+ b\np.then(f)\n.catch(g)",
+			"x = a +\n\tb;\ny = a\n\t+ b;\np.then(f)\n\t.catch(g);",
+		},
+		{
+			"switch",
+			"switch (x) {\ncase 1:\nf()\nbreak\ndefault:\ng()\n}",
+			"switch (x) {\n\tcase 1:\n\t\tf();\n\t\tbreak;\n\tdefault:\n\t\tg();\n}",
+		},
+		{
+			"semicolons",
+			"return\nx\na\n++b\nc\n(d)\nlet f = function () {\n}\ndo {\n} while (x)\nexport default {\n}",
+			"return;\nx;\na;\n++b;\nc\n(d);\nlet f = function () {\n};\ndo {\n} while (x)\nexport default {\n};",
+		},
+		{
+			"classes",
+			"class A extends B {\nget x() { return 1 }\nstatic y() {}\n}\nnew A()",
+			"class A extends B {\n\tget x() { return 1; }\n\tstatic y() {}\n}\nnew A();",
+		},
+		{
+			"comments",
+			"a() // one\n/* two */ b()\n  /**\n     * three\n       */\nc( /* four */ )",
+			"a(); // one\n/* two */ b();\n/**\n * three\n */\nc(/* four */);",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.in), "\t")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+
+			again, err := Format(got, "\t")
+			require.NoError(t, err)
+			assert.Equal(t, string(got), string(again), "formatting again changes it")
+		})
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SyntaxError
+	}{
+		{"a = 'b", SyntaxError{Msg: "string literal not terminated", Line: 1, Column: 5}},
+		{"a\n/* b", SyntaxError{Msg: "comment not terminated", Line: 2, Column: 1}},
+		{"a = `b", SyntaxError{Msg: "template literal not terminated", Line: 1, Column: 5}},
+		{"a = /b\n/", SyntaxError{Msg: "regular expression not terminated", Line: 1, Column: 5}},
+		{"a = b ° c", SyntaxError{Msg: "unexpected character '°'", Line: 1, Column: 7}},
+		{"f(a]", SyntaxError{Msg: `unexpected "]"`, Line: 1, Column: 4}},
+		{"if (a) {\n  f(\n}", SyntaxError{Msg: `unexpected "}"`, Line: 3, Column: 1}},
+		{"if (a) {\n\tb()", SyntaxError{Msg: `"{" is never closed`, Line: 1, Column: 8}},
+	}
+	for _, tt := range tests {
+		_, err := Format([]byte(tt.in), "\t")
+		require.IsType(t, &SyntaxError{}, err, tt.in)
+		assert.Equal(t, tt.want, *err.(*SyntaxError), tt.in)
+	}
+
+	// statements and expressions aren't checked.
+	res, err := Format([]byte("let = = 3"), "\t")
+	require.NoError(t, err)
+	assert.Equal(t, "let = = 3;", string(res))
+}
+
+func TestChangeError(t *testing.T) {
+	// a . before a number makes it a different token.
+	_, err := Format([]byte("a = b\n  . 1"), "\t")
+	assert.Equal(t, &ChangeError{Line: 2, Column: 3}, err)
+
+	toks, err := lex([]byte("if (x) /re/.test(s)"))
+	require.NoError(t, err)
+	assert.NoError(t, check(toks, []byte("if (x) /re/.test(s);")))
+	assert.Equal(t, &ChangeError{Line: 1, Column: 8}, check(toks, []byte("if (x) / re /.test(s);")))
+	// a line break was added before the regex.
+	assert.Equal(t, &ChangeError{Line: 1, Column: 8}, check(toks, []byte("if (x)\n/re/.test(s);")))
+}
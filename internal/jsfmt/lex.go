@@ -0,0 +1,391 @@
+package jsfmt
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	numberToken
+	stringToken
+	templateToken
+	regexToken
+	punctToken
+	lineCommentToken
+	blockCommentToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// line and column are where the token starts, counting from 1.
+	line, column int
+	// newlines is how many line breaks come before the token.
+	newlines int
+}
+
+func (t *token) comment() bool {
+	return t.kind == lineCommentToken || t.kind == blockCommentToken
+}
+
+// is reports whether t is the punctuator or keyword s.
+func (t *token) is(s string) bool {
+	return t != nil && (t.kind == punctToken || t.kind == identToken) && t.text == s
+}
+
+// SyntaxError is JavaScript that can't be read. Line and
+// Column count from 1, and Column counts bytes.
+type SyntaxError struct {
+	Msg          string
+	Line, Column int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+// puncts are the punctuators, longest first.
+var puncts = []string{
+	">>>=",
+	"...", "===", "!==", "**=", "<<=", ">>=", ">>>", "&&=", "||=", "??=",
+	"=>", "==", "!=", "<=", ">=", "&&", "||", "??", "?.", "++", "--",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "**", "<<", ">>",
+	"{", "}", "(", ")", "[", "]", ";", ",", "<", ">", "+", "-", "*", "/",
+	"%", "&", "|", "^", "!", "~", "?", ":", "=", ".", "@",
+}
+
+// regexAfter are the keywords that an expression, and
+// so a regular expression rather than a division, can follow.
+var regexAfter = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true,
+	"new": true, "delete": true, "void": true, "throw": true, "case": true,
+	"do": true, "else": true, "yield": true, "await": true,
+}
+
+// headerKeywords are the statements whose ( ) can be followed
+// by their body, which can start with a regular expression.
+var headerKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "with": true,
+}
+
+type lexer struct {
+	src          []byte
+	pos          int
+	line, column int
+	toks         []token
+	// newlines is how many line breaks come before the token being read.
+	newlines int
+	// parens has an entry for each ( that is open, which is set if
+	// it's the ( ) of a statement like if. closedHeader is set if
+	// the last ) was one of those.
+	parens       []bool
+	closedHeader bool
+}
+
+// lex splits src into tokens.
+func lex(src []byte) ([]token, error) {
+	l := &lexer{src: src, line: 1, column: 1}
+	for {
+		for l.pos < len(l.src) {
+			r, size := utf8.DecodeRune(l.src[l.pos:])
+			if r == '\n' || r == '\u2028' || r == '\u2029' {
+				l.newlines++
+			} else if !unicode.IsSpace(r) && r != '\ufeff' {
+				break
+			}
+			l.advance(size)
+		}
+		if l.pos >= len(l.src) {
+			return l.toks, nil
+		}
+
+		tok := token{line: l.line, column: l.column, newlines: l.newlines}
+		start := l.pos
+		kind, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		l.newlines = 0
+		tok.kind = kind
+		tok.text = string(l.src[start:l.pos])
+		l.toks = append(l.toks, tok)
+	}
+}
+
+// advance moves on n bytes, keeping track of lines and columns.
+func (l *lexer) advance(n int) {
+	for _, c := range l.src[l.pos : l.pos+n] {
+		if c == '\n' {
+			l.line++
+			l.column = 1
+		} else {
+			l.column++
+		}
+	}
+	l.pos += n
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n >= len(l.src) {
+		return 0
+	}
+	return l.src[l.pos+n]
+}
+
+func (l *lexer) errorf(line, column int, format string, args ...interface{}) error {
+	return &SyntaxError{Msg: fmt.Sprintf(format, args...), Line: line, Column: column}
+}
+
+// next reads the token at l.pos.
+func (l *lexer) next() (tokenKind, error) {
+	c := l.src[l.pos]
+	r, size := utf8.DecodeRune(l.src[l.pos:])
+	switch {
+	case c == '/' && l.peek(1) == '/':
+		l.lineComment()
+		return lineCommentToken, nil
+	case c == '/' && l.peek(1) == '*':
+		return blockCommentToken, l.blockComment()
+	case c == '"' || c == '\'':
+		return stringToken, l.string()
+	case c == '`':
+		return templateToken, l.template()
+	case isDigit(c) || c == '.' && isDigit(l.peek(1)):
+		l.number()
+		return numberToken, nil
+	case c == '#' || c == '\\' || isIdentStart(r):
+		l.advance(size)
+		l.ident()
+		return identToken, nil
+	case c == '/' && l.regexAllowed():
+		return regexToken, l.regex()
+	}
+	for _, p := range puncts {
+		if l.pos+len(p) <= len(l.src) && string(l.src[l.pos:l.pos+len(p)]) == p {
+			if p == "?." && isDigit(l.peek(2)) {
+				// a ? .5 : 1
+				continue
+			}
+			l.advance(len(p))
+			l.paren(p)
+			return punctToken, nil
+		}
+	}
+	return 0, l.errorf(l.line, l.column, "unexpected character %q", r)
+}
+
+// last is the last token that isn't a comment, or nil.
+func (l *lexer) last() *token {
+	for i := len(l.toks) - 1; i >= 0; i-- {
+		if !l.toks[i].comment() {
+			return &l.toks[i]
+		}
+	}
+	return nil
+}
+
+// paren keeps track of the ( ) of statements like if, after
+// the punctuator p.
+func (l *lexer) paren(p string) {
+	switch p {
+	case "(":
+		t := l.last()
+		l.parens = append(l.parens, t != nil && t.kind == identToken && headerKeywords[t.text])
+	case ")":
+		l.closedHeader = false
+		if n := len(l.parens); n > 0 {
+			l.closedHeader = l.parens[n-1]
+			l.parens = l.parens[:n-1]
+		}
+	}
+}
+
+// regexAllowed reports whether a / starts a regular
+// expression, rather than being a division.
+func (l *lexer) regexAllowed() bool {
+	t := l.last()
+	switch {
+	case t == nil:
+		return true
+	case t.is(")"):
+		// if (x) /re/.test(s)
+		return l.closedHeader
+	case t.is("}"):
+		// a block is much more likely to be followed by
+		// a statement on the next line than an object
+		// by a division.
+		return l.newlines > 0
+	case t.is("]"):
+		return false
+	case t.kind == punctToken:
+		return true
+	case t.kind == identToken:
+		return regexAfter[t.text]
+	}
+	return false
+}
+
+func (l *lexer) lineComment() {
+	for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+		l.advance(1)
+	}
+}
+
+func (l *lexer) blockComment() error {
+	line, column := l.line, l.column
+	for i := l.pos + 2; i+1 < len(l.src); i++ {
+		if l.src[i] == '*' && l.src[i+1] == '/' {
+			l.advance(i + 2 - l.pos)
+			return nil
+		}
+	}
+	return l.errorf(line, column, "comment not terminated")
+}
+
+func (l *lexer) string() error {
+	line, column := l.line, l.column
+	quote := l.src[l.pos]
+	l.advance(1)
+	for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+		switch c := l.src[l.pos]; {
+		case c == quote:
+			l.advance(1)
+			return nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.advance(2)
+		default:
+			l.advance(1)
+		}
+	}
+	return l.errorf(line, column, "string literal not terminated")
+}
+
+func (l *lexer) template() error {
+	line, column := l.line, l.column
+	l.advance(1)
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '`':
+			l.advance(1)
+			return nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.advance(2)
+		case c == '$' && l.peek(1) == '{':
+			l.advance(2)
+			if err := l.substitution(); err != nil {
+				return err
+			}
+		default:
+			l.advance(1)
+		}
+	}
+	return l.errorf(line, column, "template literal not terminated")
+}
+
+// substitution skips the expression of a ${ } in a template,
+// up to and including its }.
+func (l *lexer) substitution() error {
+	line, column := l.line, l.column
+	depth := 0
+	for l.pos < len(l.src) {
+		var err error
+		switch c := l.src[l.pos]; {
+		case c == '}' && depth == 0:
+			l.advance(1)
+			return nil
+		case c == '}':
+			depth--
+			l.advance(1)
+		case c == '{':
+			depth++
+			l.advance(1)
+		case c == '"' || c == '\'':
+			err = l.string()
+		case c == '`':
+			err = l.template()
+		case c == '/' && l.peek(1) == '/':
+			l.lineComment()
+		case c == '/' && l.peek(1) == '*':
+			err = l.blockComment()
+		default:
+			l.advance(1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return l.errorf(line, column, "template substitution not terminated")
+}
+
+func (l *lexer) number() {
+	hex := l.src[l.pos] == '0' && (l.peek(1) == 'x' || l.peek(1) == 'X')
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case (c == 'e' || c == 'E') && !hex && (l.peek(1) == '+' || l.peek(1) == '-'):
+			l.advance(2)
+		case isDigit(c) || c == '.' || c == '_' || isLetter(c):
+			l.advance(1)
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) ident() {
+	for l.pos < len(l.src) {
+		r, size := utf8.DecodeRune(l.src[l.pos:])
+		if r != '\\' && !isIdentPart(r) {
+			return
+		}
+		l.advance(size)
+	}
+}
+
+func (l *lexer) regex() error {
+	line, column := l.line, l.column
+	class := false
+	l.advance(1)
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+			return l.errorf(line, column, "regular expression not terminated")
+		}
+		c := l.src[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.advance(2)
+			continue
+		case c == '[':
+			class = true
+		case c == ']':
+			class = false
+		case c == '/' && !class:
+			l.advance(1)
+			// flags
+			l.ident()
+			return nil
+		}
+		l.advance(1)
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '$' || r == '_' || unicode.IsLetter(r)
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) ||
+		r == '\u200c' || r == '\u200d'
+}
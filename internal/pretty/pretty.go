@@ -0,0 +1,318 @@
+// Package pretty is a line-width-aware pretty printer.
+//
+// Documents are built out of text, line breaks, indentation and groups,
+// the way Wadler's "A prettier printer" describes. A group is printed on
+// one line if it fits in the width, and otherwise all of its line breaks
+// are taken. Fill is a looser kind of group, like a paragraph, that only
+// breaks the lines it has to.
+//
+// The printer knows nothing about HTML, so it can be used to lay out
+// anything that has a tree structure.
+package pretty
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// TabWidth is how many columns a tab takes up.
+const TabWidth = 4
+
+// A Doc is a document that can be laid out.
+type Doc interface {
+	// hard reports whether the document contains a line
+	// break that is always taken.
+	hard() bool
+}
+
+type text string
+
+func (t text) hard() bool { return strings.IndexByte(string(t), '\n') >= 0 }
+
+type line struct {
+	// soft lines disappear instead of becoming a space
+	// when they aren't broken.
+	soft bool
+	// forced lines are always broken.
+	forced bool
+}
+
+func (l line) hard() bool { return l.forced }
+
+type concat struct {
+	docs   []Doc
+	isHard bool
+}
+
+func (c *concat) hard() bool { return c.isHard }
+
+type indent struct {
+	doc Doc
+	// by is added to the indentation. If it's empty,
+	// the printer's Indent is.
+	by string
+}
+
+func (i *indent) hard() bool { return i.doc.hard() }
+
+type group struct {
+	doc Doc
+}
+
+func (g *group) hard() bool { return g.doc.hard() }
+
+type fill struct {
+	docs   []Doc
+	isHard bool
+}
+
+func (f *fill) hard() bool { return f.isHard }
+
+// Text is a piece of text. It should not contain line breaks unless
+// it is meant to be printed exactly as it is, like the contents of a
+// <pre> tag; the lines after the first one aren't indented.
+func Text(s string) Doc {
+	return text(s)
+}
+
+// Line is a line break, or a space if the group it's in fits on one line.
+func Line() Doc {
+	return line{}
+}
+
+// SoftLine is a line break, or nothing if the group it's in fits on one line.
+func SoftLine() Doc {
+	return line{soft: true}
+}
+
+// HardLine is a line break that is always taken. The groups around it
+// can never be printed on one line.
+func HardLine() Doc {
+	return line{forced: true}
+}
+
+// Concat puts documents one after another.
+func Concat(docs ...Doc) Doc {
+	c := &concat{docs: docs}
+	for _, d := range docs {
+		c.isHard = c.isHard || d.hard()
+	}
+	return c
+}
+
+// Indent indents the lines that d breaks by one more level.
+func Indent(d Doc) Doc {
+	return &indent{doc: d}
+}
+
+// Align indents the lines that d breaks by s, rather than by a level.
+func Align(s string, d Doc) Doc {
+	return &indent{doc: d, by: s}
+}
+
+// Group prints d on one line if it fits, and breaks all of its
+// lines (but not the lines of the groups inside it) if it doesn't.
+func Group(d Doc) Doc {
+	return &group{doc: d}
+}
+
+// Fill lays out docs like the words of a paragraph. docs alternates
+// between content and separators, which are usually lines. A separator
+// is only broken if the content after it doesn't fit on the line.
+func Fill(docs ...Doc) Doc {
+	f := &fill{docs: docs}
+	for _, d := range docs {
+		f.isHard = f.isHard || d.hard()
+	}
+	return f
+}
+
+// Printer lays out documents.
+type Printer struct {
+	// Width is the preferred maximum line width.
+	Width int
+	// Indent is one level of indentation.
+	Indent string
+	// Margin is what every line after the first one starts with.
+	Margin string
+	// Column is where the first line starts.
+	Column int
+}
+
+// mode is how a document is being printed.
+type mode int
+
+const (
+	flat mode = iota
+	broken
+)
+
+// cmd is a document waiting to be printed.
+type cmd struct {
+	indent string
+	mode   mode
+	doc    Doc
+}
+
+// Fprint lays out d and writes it to w.
+func (p *Printer) Fprint(w io.Writer, d Doc) error {
+	bw := bufio.NewWriter(w)
+	col := p.Column
+	// pending is indentation that hasn't been written yet,
+	// so that empty lines don't end up with trailing whitespace.
+	pending := ""
+	stack := []cmd{{indent: p.Margin, mode: broken, doc: d}}
+
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := c.doc.(type) {
+		case text:
+			s := string(d)
+			if s == "" {
+				continue
+			}
+			if s[0] != '\n' {
+				bw.WriteString(pending)
+			}
+			pending = ""
+			bw.WriteString(s)
+			if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+				col = Width(s[i+1:])
+			} else {
+				col += Width(s)
+			}
+		case line:
+			if c.mode == flat && !d.forced {
+				if !d.soft {
+					bw.WriteString(pending + " ")
+					pending = ""
+					col++
+				}
+				continue
+			}
+			bw.WriteByte('\n')
+			pending = c.indent
+			col = Width(c.indent)
+		case *concat:
+			for i := len(d.docs) - 1; i >= 0; i-- {
+				stack = append(stack, cmd{c.indent, c.mode, d.docs[i]})
+			}
+		case *indent:
+			by := d.by
+			if by == "" {
+				by = p.Indent
+			}
+			stack = append(stack, cmd{c.indent + by, c.mode, d.doc})
+		case *group:
+			m := broken
+			if c.mode == flat || (!d.hard() && p.fits(cmd{c.indent, flat, d.doc}, stack, p.Width-col)) {
+				m = flat
+			}
+			stack = append(stack, cmd{c.indent, m, d.doc})
+		case *fill:
+			stack = p.fill(stack, c, d.docs, col)
+		}
+	}
+	return bw.Flush()
+}
+
+// fill pushes the commands that print the start of a fill onto stack.
+func (p *Printer) fill(stack []cmd, c cmd, docs []Doc, col int) []cmd {
+	if len(docs) == 0 {
+		return stack
+	}
+	rem := p.Width - col
+
+	// Whatever comes after the content has to fit too,
+	// up to where the line can be broken.
+	content := cmd{c.indent, flat, docs[0]}
+	after := append(stack[:len(stack):len(stack)], cmd{c.indent, c.mode, &fill{docs: docs[1:]}})
+	if c.mode == broken && (docs[0].hard() || !p.fits(content, after, rem)) {
+		content.mode = broken
+	}
+	if len(docs) == 1 {
+		return append(stack, content)
+	}
+
+	sep := cmd{c.indent, flat, docs[1]}
+	if len(docs) == 2 {
+		if content.mode == broken {
+			sep.mode = broken
+		}
+		return append(stack, sep, content)
+	}
+
+	// The separator is broken if the content after it won't fit
+	// on the same line as the content before it.
+	both := cmd{c.indent, flat, Concat(docs[0], docs[1], docs[2])}
+	after = append(stack[:len(stack):len(stack)], cmd{c.indent, c.mode, &fill{docs: docs[3:]}})
+	if c.mode == broken && (both.doc.hard() || !p.fits(both, after, rem)) {
+		sep.mode = broken
+	}
+	rest := cmd{c.indent, c.mode, &fill{docs: docs[2:]}}
+	return append(stack, rest, sep, content)
+}
+
+// fits reports whether next fits in width columns, followed by as
+// much of rest as is needed to get to the next line break.
+func (p *Printer) fits(next cmd, rest []cmd, width int) bool {
+	stack := []cmd{next}
+	for width >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := c.doc.(type) {
+		case text:
+			s := string(d)
+			if i := strings.IndexByte(s, '\n'); i >= 0 {
+				return width-Width(s[:i]) >= 0
+			}
+			width -= Width(s)
+		case line:
+			if c.mode == broken || d.forced {
+				return true
+			}
+			if !d.soft {
+				width--
+			}
+		case *concat:
+			for i := len(d.docs) - 1; i >= 0; i-- {
+				stack = append(stack, cmd{c.indent, c.mode, d.docs[i]})
+			}
+		case *indent:
+			stack = append(stack, cmd{c.indent, c.mode, d.doc})
+		case *group:
+			m := c.mode
+			if d.hard() {
+				m = broken
+			}
+			stack = append(stack, cmd{c.indent, m, d.doc})
+		case *fill:
+			// only the part of a fill up to the next line
+			// break is needed, so the rest is pushed lazily.
+			if len(d.docs) > 1 {
+				stack = append(stack, cmd{c.indent, c.mode, &fill{docs: d.docs[1:]}})
+			}
+			if len(d.docs) > 0 {
+				stack = append(stack, cmd{c.indent, c.mode, d.docs[0]})
+			}
+		}
+	}
+	return false
+}
+
+// Width is how many columns s takes up.
+func Width(s string) int {
+	return utf8.RuneCountInString(s) + strings.Count(s, "\t")*(TabWidth-1)
+}
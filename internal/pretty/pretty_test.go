@@ -0,0 +1,96 @@
+package pretty
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func print(t *testing.T, p *Printer, d Doc) string {
+	var buf bytes.Buffer
+	require.NoError(t, p.Fprint(&buf, d))
+	return buf.String()
+}
+
+// element is a tiny html-like element with children.
+func element(name string, children ...Doc) Doc {
+	var inner []Doc
+	for i, c := range children {
+		if i > 0 {
+			inner = append(inner, Line())
+		}
+		inner = append(inner, c)
+	}
+	return Group(Concat(
+		Text("<"+name+">"),
+		Indent(Concat(SoftLine(), Concat(inner...))),
+		SoftLine(),
+		Text("</"+name+">"),
+	))
+}
+
+func TestGroup(t *testing.T) {
+	d := element("div", Text("Updated:"), element("span", Text("now")))
+
+	assert.Equal(t, "<div>Updated: <span>now</span></div>", print(t, &Printer{Width: 80, Indent: "  "}, d))
+	assert.Equal(t,
+		"<div>\n  Updated:\n  <span>now</span>\n</div>",
+		print(t, &Printer{Width: 30, Indent: "  "}, d))
+	assert.Equal(t,
+		"<div>\n  Updated:\n  <span>\n    now\n  </span>\n</div>",
+		print(t, &Printer{Width: 10, Indent: "  "}, d))
+}
+
+func TestHardLine(t *testing.T) {
+	d := Group(Concat(Text("a"), Indent(Concat(Line(), Text("b"), HardLine(), HardLine(), Text("c"))), Line(), Text("d")))
+	// the blank line doesn't get any indentation.
+	assert.Equal(t, "a\n\tb\n\n\tc\nd", print(t, &Printer{Width: 80, Indent: "\t"}, d))
+}
+
+func TestFill(t *testing.T) {
+	var words []Doc
+	for i, w := range []string{"one", "two", "three", "four", "five"} {
+		if i > 0 {
+			words = append(words, Line())
+		}
+		words = append(words, Text(w))
+	}
+	assert.Equal(t, "one two\nthree\nfour five", print(t, &Printer{Width: 9}, Fill(words...)))
+	assert.Equal(t, "one two three four five", print(t, &Printer{Width: 80}, Fill(words...)))
+}
+
+func TestMargin(t *testing.T) {
+	d := Group(Concat(Text("<a>"), Indent(Concat(Line(), Text("text"))), Line(), Text("</a>")))
+	assert.Equal(t,
+		"<a>\n        text\n    </a>",
+		print(t, &Printer{Width: 10, Indent: "    ", Margin: "    ", Column: 4}, d))
+}
+
+func TestAlign(t *testing.T) {
+	d := Concat(Text("<!--"), Align("  ", Concat(HardLine(), Text("a"), HardLine(), Indent(Concat(Text("b"), HardLine(), Text("c"))))), HardLine(), Text("-->"))
+	assert.Equal(t, "<!--\n  a\n  b\n  \tc\n-->", print(t, &Printer{Width: 80, Indent: "\t"}, d))
+}
+
+func TestVerbatimText(t *testing.T) {
+	// text with line breaks in it is printed as is, and doesn't fit.
+	d := Group(Concat(Text("<pre>"), Indent(Concat(SoftLine(), Text("a\n  b"))), SoftLine(), Text("</pre>")))
+	assert.Equal(t, "<pre>\n    a\n  b\n</pre>", print(t, &Printer{Width: 80, Indent: "    "}, d))
+}
+
+func TestWidth(t *testing.T) {
+	assert.Equal(t, 3, Width("héé"))
+	assert.Equal(t, TabWidth+1, Width("\ta"))
+}
+
+func TestFillLong(t *testing.T) {
+	// checking whether a word fits mustn't look at all the words after it.
+	var words []Doc
+	for i := 0; i < 100000; i++ {
+		words = append(words, Text("word"), Line())
+	}
+	out := print(t, &Printer{Width: 80}, Fill(words...))
+	assert.Equal(t, 100000, strings.Count(out, "word"))
+}
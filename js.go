@@ -0,0 +1,53 @@
+package vugufmt
+
+import (
+	"context"
+
+	"github.com/erinpentecost/vugufmt/internal/jsfmt"
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// jsScriptTypes are the types of script blocks that are JavaScript.
+// Blocks without a type are too.
+var jsScriptTypes = []string{"", "text/javascript", "application/javascript", "module"}
+
+// UseJSFmt sets the formatter to format JavaScript script blocks, without
+// needing Node. Lines are indented by how deeply they're nested, tokens
+// are spaced out the same way everywhere, semicolons that JavaScript
+// would insert are written out, and strings are double quoted. Line
+// breaks and comments are kept. Blocks that formatting would change
+// the meaning of are left as they are, and reported to Diagnostic.
+// Syntax isn't checked beyond tokens and brackets, so a block like
+// let = = 3 is formatted rather than reported as an error.
+func UseJSFmt(f *Formatter) {
+	for _, t := range jsScriptTypes {
+		f.Scripts[t] = jsFmt{f: f}
+	}
+}
+
+// jsFmt formats JavaScript with the indentation of f.
+type jsFmt struct {
+	f *Formatter
+}
+
+func (j jsFmt) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	res, err := jsfmt.Format(req.Src, j.f.indent())
+	switch err := err.(type) {
+	case nil:
+		return ScriptResult{Src: res}, nil
+	case *jsfmt.SyntaxError:
+		return ScriptResult{}, &FmtError{Msg: err.Msg, Line: err.Line, Column: err.Column}
+	case *jsfmt.ChangeError:
+		if j.f.Diagnostic != nil {
+			p := req.Region.ToHost(srcmap.Position{Line: err.Line, Column: err.Column})
+			j.f.Diagnostic(&FmtError{
+				Msg:      "JavaScript left as it is, since formatting it would change what it does",
+				FileName: req.Filename,
+				Line:     p.Line,
+				Column:   p.Column,
+			})
+		}
+		return ScriptResult{Src: req.Src}, nil
+	}
+	return ScriptResult{}, err
+}
@@ -0,0 +1,40 @@
+package vugufmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseJSFmt(t *testing.T) {
+	formatter := NewFormatter(UseJSFmt)
+	formatter.Indent = "\t"
+
+	assert.Equal(t,
+		"<script type=\"text/JavaScript\">\nif (a) {\n\tb();\n}\n</script>\n",
+		formatString(t, formatter, "<script type=\"text/JavaScript\">\nif(a){\n  b()\n}\n</script>\n"))
+	// other scripts are left alone.
+	assert.Equal(t, "<script type=\"text/x\">a=b</script>\n", formatString(t, formatter, "<script type=\"text/x\">a=b</script>\n"))
+
+	// errors are where they are in the file.
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("x.vugu", strings.NewReader("<div>\n  <script>a = (b</script>\n</div>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:2:15: \"(\" is never closed", err.Error())
+
+	err = formatter.FormatHTML("x.vugu", strings.NewReader("<script>\na = 1\nb = 'c\n</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:3:5: string literal not terminated", err.Error())
+
+	// scripts that formatting would break are left alone.
+	var diags []string
+	formatter.Diagnostic = func(d *FmtError) { diags = append(diags, d.Error()) }
+	src := "<div>\n  <script>a = b\n  . 1</script>\n</div>\n"
+	buf.Reset()
+	require.Nil(t, formatter.FormatHTML("x.vugu", strings.NewReader(src), &buf))
+	assert.Equal(t, src, buf.String())
+	assert.Equal(t, []string{"x.vugu:3:3: JavaScript left as it is, since formatting it would change what it does"}, diags)
+}
@@ -0,0 +1,424 @@
+package vugufmt
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+	"github.com/erinpentecost/vugufmt/internal/pretty"
+)
+
+// UseMaxWidth sets the preferred maximum line width,
+// and lays documents out to fit in it.
+func UseMaxWidth(width int) func(*Formatter) {
+	return func(f *Formatter) {
+		f.MaxWidth = width
+	}
+}
+
+// nodeKind is the kind of a layoutNode.
+type nodeKind int
+
+const (
+	elementNode nodeKind = iota
+	textNode
+	// verbatimNode is printed exactly as it was, like doctypes
+	// and the contents of script blocks.
+	verbatimNode
+	commentNode
+)
+
+// layoutNode is a node of the tree that layoutWriter builds.
+type layoutNode struct {
+	kind nodeKind
+	atom atom.Atom
+	// raw is the start tag of an element, or all of any other node.
+	raw   []byte
+	attrs []htmlx.RawAttribute
+	// end is the end tag of an element. It is nil for self-closing tags.
+	end      []byte
+	children []*layoutNode
+	parent   *layoutNode
+}
+
+// layoutWriter builds a tree out of a document, so that it can be
+// laid out to fit in the formatter's MaxWidth once it's complete.
+type layoutWriter struct {
+	f    *Formatter
+	root layoutNode
+	cur  *layoutNode
+	// preDepth is how deep inside of an element that preserves
+	// whitespace, like <pre>, the writer is.
+	preDepth int
+}
+
+// preformatted reports whether whitespace matters inside of an element.
+func preformatted(a atom.Atom) bool {
+	return atom.Info(a).PreserveSpace
+}
+
+// rawText reports whether an element's contents are
+// never laid out, like those of script blocks.
+func rawText(a atom.Atom) bool {
+	return atom.Info(a).RawText
+}
+
+func (l *layoutWriter) add(n *layoutNode) {
+	if l.cur == nil {
+		l.cur = &l.root
+	}
+	n.parent = l.cur
+	l.cur.children = append(l.cur.children, n)
+}
+
+// verbatim adds raw to the document as it is.
+func (l *layoutWriter) verbatim(raw []byte) {
+	if l.cur != nil {
+		if i := len(l.cur.children) - 1; i >= 0 && l.cur.children[i].kind == verbatimNode {
+			l.cur.children[i].raw = append(l.cur.children[i].raw, raw...)
+			return
+		}
+	}
+	l.add(&layoutNode{kind: verbatimNode, raw: raw})
+}
+
+func (l *layoutWriter) startTag(raw []byte, attrs []htmlx.RawAttribute, tok *htmlx.Token) {
+	if l.preDepth > 0 {
+		l.verbatim(raw)
+		if tok.Type == htmlx.StartTagToken {
+			l.preDepth++
+		}
+		return
+	}
+
+	n := &layoutNode{kind: elementNode, atom: tok.DataAtom, raw: raw, attrs: attrs}
+	l.add(n)
+	if tok.Type == htmlx.SelfClosingTagToken {
+		return
+	}
+	l.cur = n
+	if preformatted(tok.DataAtom) {
+		l.preDepth = 1
+	}
+}
+
+func (l *layoutWriter) endTag(raw []byte) {
+	if l.preDepth > 1 {
+		l.verbatim(raw)
+		l.preDepth--
+		return
+	}
+	l.preDepth = 0
+	l.cur.end = raw
+	l.cur = l.cur.parent
+}
+
+func (l *layoutWriter) text(raw []byte, verbatim bool) {
+	if verbatim || l.preDepth > 0 {
+		l.verbatim(raw)
+		return
+	}
+	l.add(&layoutNode{kind: textNode, raw: raw})
+}
+
+func (l *layoutWriter) other(raw []byte) {
+	if l.preDepth == 0 && bytes.HasPrefix(raw, []byte("<!--")) && bytes.HasSuffix(raw, []byte("-->")) {
+		l.add(&layoutNode{kind: commentNode, raw: raw})
+		return
+	}
+	l.verbatim(raw)
+}
+
+// print lays out the document and writes it to out.
+func (l *layoutWriter) print(out io.Writer, linePrefix []byte) error {
+	prefix := string(linePrefix)
+	p := &pretty.Printer{
+		Width:  l.f.MaxWidth,
+		Indent: l.f.indent(),
+		Margin: prefix[:len(prefix)-len(strings.TrimLeft(prefix, " \t"))],
+		Column: pretty.Width(prefix),
+	}
+
+	c := l.f.layoutChildren(l.root.children)
+	doc := c.fill()
+	// Whitespace at the start of the document is dropped, and
+	// whitespace at its end is reduced to a single line break.
+	if c.trail >= newLine {
+		doc = pretty.Concat(doc, pretty.HardLine())
+	}
+	return p.Fprint(out, doc)
+}
+
+// space is the whitespace between two nodes.
+type space int
+
+const (
+	noSpace space = iota
+	// softBreak is where whitespace doesn't matter. It can be
+	// left out, or a line break can be added.
+	softBreak
+	// sameLine is whitespace without any line breaks.
+	sameLine
+	newLine
+	blankLine
+)
+
+// spaceOf tells what kind of space ws is.
+func spaceOf(ws []byte) space {
+	switch bytes.Count(ws, []byte("\n")) {
+	case 0:
+		if len(ws) == 0 {
+			return noSpace
+		}
+		return sameLine
+	case 1:
+		return newLine
+	}
+	return blankLine
+}
+
+// doc is how a space is laid out. Spaces within a line can be broken
+// if they have to, and line breaks are kept, so that the source decides
+// which elements go on their own lines.
+func (s space) doc() pretty.Doc {
+	switch s {
+	case softBreak:
+		return pretty.SoftLine()
+	case sameLine:
+		return pretty.Line()
+	case newLine:
+		return pretty.HardLine()
+	case blankLine:
+		return pretty.Concat(pretty.HardLine(), pretty.HardLine())
+	}
+	return pretty.Text("")
+}
+
+// insignificant is what s becomes where whitespace doesn't render,
+// like next to a block element. Line breaks are still kept.
+func (s space) insignificant() space {
+	if s < newLine {
+		return softBreak
+	}
+	return s
+}
+
+// atMost returns s, or max if s is more than that.
+func (s space) atMost(max space) space {
+	if s > max {
+		return max
+	}
+	return s
+}
+
+// itemKind is what an item of content is.
+type itemKind int
+
+const (
+	inlineItem itemKind = iota
+	blockItem
+	// wordItem is text.
+	wordItem
+)
+
+// content is a list of nodes laid out next to each other.
+type content struct {
+	// reflow is whether text can be moved onto other lines.
+	reflow bool
+	items  []pretty.Doc
+	// spaces holds the space before each item.
+	spaces []space
+	// trail is the space after the last item.
+	trail space
+	// first and last are the kinds of the first and last items.
+	first, last itemKind
+}
+
+// addSpace adds whitespace after the last item.
+func (c *content) addSpace(s space) {
+	if s > c.trail {
+		c.trail = s
+	}
+}
+
+// addItem adds a doc after the last item. Items that can't
+// have a line break between them are joined together.
+func (c *content) addItem(d pretty.Doc, kind itemKind) {
+	s := c.trail
+	if n := len(c.items); n > 0 {
+		switch {
+		case kind == blockItem || c.last == blockItem:
+			s = s.insignificant()
+		case c.reflow && s == newLine && (kind == wordItem || c.last == wordItem):
+			// line breaks in text are only where the text was
+			// wrapped before, so it can be wrapped again.
+			s = sameLine
+		}
+		if s == noSpace {
+			c.items[n-1] = pretty.Concat(c.items[n-1], d)
+			c.trail = noSpace
+			c.last = kind
+			return
+		}
+	} else {
+		c.first = kind
+	}
+	c.items = append(c.items, d)
+	c.spaces = append(c.spaces, s)
+	c.trail = noSpace
+	c.last = kind
+}
+
+// lead is the space before the first item.
+func (c *content) lead() space {
+	if len(c.spaces) == 0 {
+		return noSpace
+	}
+	return c.spaces[0]
+}
+
+// fill lays out the items like a paragraph.
+func (c *content) fill() pretty.Doc {
+	var docs []pretty.Doc
+	for i, item := range c.items {
+		if i > 0 {
+			docs = append(docs, c.spaces[i].doc())
+		}
+		docs = append(docs, item)
+	}
+	return pretty.Fill(docs...)
+}
+
+// layoutChildren turns a list of nodes into content.
+func (f *Formatter) layoutChildren(nodes []*layoutNode) *content {
+	c := &content{reflow: f.Reflow}
+	for _, n := range nodes {
+		switch n.kind {
+		case elementNode:
+			kind := inlineItem
+			if f.isBlock(n.atom) {
+				kind = blockItem
+			}
+			c.addItem(f.layoutElement(n), kind)
+		case textNode:
+			splitText(c, n.raw)
+		case commentNode:
+			c.addItem(f.layoutComment(n.raw), inlineItem)
+		default:
+			c.addItem(pretty.Text(string(n.raw)), inlineItem)
+		}
+	}
+	return c
+}
+
+// layoutElement lays out an element and everything inside of it.
+func (f *Formatter) layoutElement(n *layoutNode) pretty.Doc {
+	start := f.layoutStartTag(n)
+	if n.end == nil {
+		return start
+	}
+	end := pretty.Text(string(n.end))
+
+	block := f.isBlock(n.atom)
+	c := f.layoutChildren(n.children)
+	if len(c.items) == 0 {
+		if block {
+			return pretty.Concat(start, end)
+		}
+		return pretty.Group(pretty.Concat(start, c.trail.atMost(newLine).doc(), end))
+	}
+
+	// Whitespace at the start and end of a block doesn't
+	// render, unless it is preformatted. Script and style
+	// blocks are kept as they are too.
+	inside := block && !preformatted(n.atom) && !rawText(n.atom)
+	lead, trail := c.lead().atMost(newLine), c.trail.atMost(newLine)
+	if inside || c.first == blockItem {
+		lead = lead.insignificant()
+	}
+	if inside || c.last == blockItem {
+		trail = trail.insignificant()
+	}
+	return pretty.Group(pretty.Concat(
+		start,
+		pretty.Indent(pretty.Concat(lead.doc(), c.fill())),
+		trail.doc(),
+		end,
+	))
+}
+
+// layoutStartTag lays out a start tag, with its attributes
+// on their own lines if it doesn't fit.
+func (f *Formatter) layoutStartTag(n *layoutNode) pretty.Doc {
+	name := tagName(n.raw)
+	end := tagEnd(n.raw, n.attrs)
+	parts := f.attributeParts(n.attrs)
+	if len(parts) == 0 {
+		return pretty.Text("<" + name + end)
+	}
+
+	sep := pretty.Line()
+	if f.wrapAttributes(len(parts)) {
+		sep = pretty.HardLine()
+	}
+	var attrs []pretty.Doc
+	for _, p := range parts {
+		attrs = append(attrs, sep, pretty.Text(p))
+	}
+
+	closing := pretty.Concat(pretty.SoftLine(), pretty.Text(end))
+	if end == " />" {
+		closing = pretty.Concat(pretty.Line(), pretty.Text("/>"))
+	}
+	return pretty.Group(pretty.Concat(
+		pretty.Text("<"+name),
+		pretty.Indent(pretty.Concat(attrs...)),
+		closing,
+	))
+}
+
+// splitText adds a text node to c. Whitespace at either end of it, and
+// whitespace with line breaks in it, separates the text from what's
+// around it. Other whitespace is kept as it is, unless c reflows text,
+// in which case every word is separate.
+func splitText(c *content, raw []byte) {
+	start := -1
+	pos := 0
+	for pos < len(raw) {
+		if !isSpace(raw[pos]) {
+			if start < 0 {
+				start = pos
+			}
+			pos++
+			continue
+		}
+
+		end := pos
+		for pos < len(raw) && isSpace(raw[pos]) {
+			pos++
+		}
+		ws := raw[end:pos]
+		if start >= 0 && pos < len(raw) && bytes.IndexByte(ws, '\n') < 0 && !c.reflow {
+			continue
+		}
+		if start >= 0 {
+			c.addItem(pretty.Text(string(raw[start:end])), wordItem)
+			start = -1
+		}
+		c.addSpace(spaceOf(ws))
+	}
+	if start >= 0 {
+		c.addItem(pretty.Text(string(raw[start:])), wordItem)
+	}
+}
+
+// isSpace reports whether b is HTML whitespace.
+func isSpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
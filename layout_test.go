@@ -0,0 +1,76 @@
+package vugufmt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayoutFits(t *testing.T) {
+	src := "<div>Updated: <span vg-html='data.bpi.Time.Updated'></span></div>"
+	assert.Equal(t, src, formatString(t, NewFormatter(UseMaxWidth(80)), src))
+
+	// there's no whitespace after <div> or before </div>,
+	// so the only place it can break is after "Updated:".
+	assert.Equal(t,
+		"<div>Updated:\n    <span vg-html='data.bpi.Time.Updated'></span></div>",
+		formatString(t, NewFormatter(UseMaxWidth(60)), src))
+
+	assert.Equal(t,
+		"<div>Updated:\n    <span\n        vg-html='data.bpi.Time.Updated'\n    ></span></div>",
+		formatString(t, NewFormatter(UseMaxWidth(30)), src))
+}
+
+func TestLayoutIndents(t *testing.T) {
+	formatter := NewFormatter(UseMaxWidth(80))
+	assert.Equal(t,
+		"<ul>\n    <li>\n        <span>a</span> <span>b</span>\n    </li>\n\n    <li></li></ul>\n",
+		formatString(t, formatter, "  <ul>\n<li>\n\t<span>a</span> <span>b</span>\n  </li>\n\n\n<li></li></ul>\n\n"))
+
+	formatter.Indent = "\t"
+	assert.Equal(t,
+		"<ul>\n\t<li> x </li>\n</ul>",
+		formatString(t, formatter, "<ul>\n    <li> x </li>\n</ul>"))
+}
+
+func TestLayoutVerbatim(t *testing.T) {
+	formatter := NewFormatter(UseMaxWidth(20), upperFormatter)
+
+	src := "<div>\n<pre>  a   <b>b</b>\n  c</pre>\n<!--   a comment\n  that is long -->\n</div>"
+	assert.Equal(t,
+		"<div>\n    <pre>  a   <b>b</b>\n  c</pre>\n    <!--   a comment\n  that is long -->\n</div>",
+		formatString(t, formatter, src))
+
+	// script blocks are formatted, but not laid out.
+	formatter.MaxWidth = 30
+	assert.Equal(t,
+		"<div>\n    <script type='upper'>\n  ONE TWO THREE FOUR\n</script>\n</div>",
+		formatString(t, formatter, "<div>\n<script type='upper'>\n  one two three four\n</script>\n</div>"))
+}
+
+func TestLayoutIdempotent(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "ok", "root.vugu"))
+	require.NoError(t, err)
+
+	for _, width := range []int{100, 60, 30, 10} {
+		formatter := NewFormatter(UseGoFmt(false), UseMaxWidth(width))
+		once := formatString(t, formatter, string(src))
+		assert.Equal(t, once, formatString(t, formatter, once), "width %d", width)
+	}
+
+	// testdata/ok is already laid out for 100 columns, but
+	// for one line.
+	formatter := NewFormatter(UseGoFmt(false), UseMaxWidth(110))
+	assert.Equal(t, string(src), formatString(t, formatter, string(src)))
+}
+
+func TestLayoutRange(t *testing.T) {
+	formatter := NewFormatter(UseMaxWidth(20))
+	src := "<div>\n    <p>some <b>long</b> text</p>\n    <p>some <b>long</b> text</p>\n</div>\n"
+	res, err := formatter.FormatRange("", []byte(src), []LineRange{{2, 2}})
+	require.Nil(t, err)
+	assert.Equal(t, "<div>\n    <p>some\n        <b>long</b>\n        text</p>\n    <p>some <b>long</b> text</p>\n</div>\n", string(res))
+}
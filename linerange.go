@@ -0,0 +1,271 @@
+package vugufmt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// ParseLineRanges parses a comma-separated list of ranges
+// like "10:40,52:60". A single number such as "12" is
+// the same as "12:12".
+func ParseLineRanges(s string) ([]LineRange, error) {
+	var ranges []LineRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, ":", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad line range %q: %s", part, err)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad line range %q: %s", part, err)
+			}
+		}
+		r := LineRange{Start: start, End: end}
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func (r LineRange) String() string {
+	return fmt.Sprintf("%d:%d", r.Start, r.End)
+}
+
+func (r LineRange) validate() error {
+	if r.Start < 1 || r.End < r.Start {
+		return fmt.Errorf("bad line range %s", r)
+	}
+	return nil
+}
+
+// FormatRange formats only the parts of src that are covered
+// by ranges, leaving every other line untouched.
+// A range that only partially covers an element or a script
+// block is expanded to the smallest element that encloses it,
+// since formatting half of a node isn't possible.
+// Lines outside the ranges keep their line endings, and
+// AutoFix isn't applied, since its repairs can reach
+// outside the ranges.
+func (f *Formatter) FormatRange(filename string, src []byte, ranges []LineRange) ([]byte, *FmtError) {
+	return f.FormatRangeContext(context.Background(), filename, src, ranges)
+}
+
+// FormatRangeContext is FormatRange with a context, which is passed
+// on to the script formatters. Formatting stops with an error
+// if ctx is canceled.
+func (f *Formatter) FormatRangeContext(ctx context.Context, filename string, src []byte, ranges []LineRange) (out []byte, err *FmtError) {
+	defer recoverPanic(filename, nil, &err)
+	for _, r := range ranges {
+		if err := r.validate(); err != nil {
+			return src, &FmtError{Msg: err.Error(), FileName: filename}
+		}
+	}
+
+	// the lines outside the ranges keep their line endings,
+	// and their tag structure isn't repaired.
+	s, ferr := f.decodeSource(filename, src)
+	if ferr != nil {
+		return src, ferr
+	}
+	res, ferr := f.formatRange(ctx, filename, s.text, ranges, f.useCRLF(s))
+	if ferr == nil {
+		res, ferr = f.encodeSource(filename, s, res)
+	}
+	if ferr != nil {
+		return src, ferr
+	}
+	return res, nil
+}
+
+// formatRange formats the nodes of src that ranges cover. The
+// lines of the formatted nodes end with \r\n if useCRLF is set.
+func (f *Formatter) formatRange(ctx context.Context, filename string, src []byte, ranges []LineRange, useCRLF bool) ([]byte, *FmtError) {
+	root, ferr := scanNodes(src)
+	if ferr != nil {
+		ferr.FileName = filename
+		return src, ferr
+	}
+
+	var selected []*nodeSpan
+	for _, r := range ranges {
+		selected = root.cover(r, selected)
+	}
+	selected = outermost(selected)
+
+	var res bytes.Buffer
+	last := 0
+	for _, n := range selected {
+		res.Write(src[last:n.start])
+
+		var buf bytes.Buffer
+		text := bytes.Replace(src[n.start:n.end], crlf, lf, -1)
+		lineStart := bytes.LastIndexByte(src[:n.start], '\n') + 1
+		start := srcmap.Position{Offset: n.start, Line: n.startLine, Column: n.start - lineStart + 1}
+		frag := fragment{linePrefix: src[lineStart:n.start], region: srcmap.New(start, text)}
+		if err := f.formatHTML(ctx, filename, bytes.NewReader(text), &buf, frag); err != nil {
+			// positions are relative to the start of the fragment.
+			return src, regionError(frag.region, err)
+		}
+		out := buf.Bytes()
+		if useCRLF {
+			out = bytes.Replace(out, lf, crlf, -1)
+		}
+		res.Write(out)
+		last = n.end
+	}
+	res.Write(src[last:])
+
+	return res.Bytes(), nil
+}
+
+// nodeSpan is the extent of an element in a source file.
+type nodeSpan struct {
+	// start and end are byte offsets into the source.
+	// end is exclusive.
+	start, end int
+	// startLine and endLine are 1-based and inclusive.
+	startLine, endLine int
+	children           []*nodeSpan
+	// quiet is set if formatting is turned off for the node.
+	quiet bool
+}
+
+// scanNodes finds the extent of every element in src.
+// The returned node spans the whole document.
+func scanNodes(src []byte) (*nodeSpan, *FmtError) {
+	izer := htmlx.NewTokenizer(bytes.NewReader(src))
+	izer.PreserveCase(true)
+	root := &nodeSpan{end: len(src), startLine: 1, endLine: 1 + bytes.Count(src, []byte{'\n'})}
+	stack := []*nodeSpan{root}
+	var structure htmlx.Structure
+	quiet := newSuppression()
+
+	offset := 0
+	line := 1
+	for {
+		curTokType := izer.Next()
+		if curTokType == htmlx.ErrorToken {
+			tok := izer.Token()
+			switch err := izer.Err(); {
+			case err != io.EOF:
+				return nil, syntaxError(&tok, "%s", err)
+			case len(izer.RawData()) > 0:
+				return nil, syntaxError(&tok, "unexpected end of file in a tag")
+			}
+			if err := structure.End(); err != nil {
+				return nil, structureError(err)
+			}
+			return root, nil
+		}
+
+		raw := append([]byte(nil), izer.RawData()...)
+		curTok := izer.Token()
+		start := offset
+		startLine := line
+		offset += len(raw)
+		line += bytes.Count(raw, []byte{'\n'})
+
+		switch curTokType {
+		case htmlx.StartTagToken:
+			structure.Open(&curTok, start)
+			n := &nodeSpan{start: start, startLine: startLine}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case htmlx.EndTagToken:
+			if err := structure.Close(&curTok, start); err != nil {
+				return nil, structureError(err)
+			}
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			n.end = offset
+			n.endLine = line
+		}
+
+		if quiet.quiet(curTokType, raw, structure.Depth()) && curTokType == htmlx.StartTagToken {
+			stack[len(stack)-1].quiet = true
+		}
+	}
+}
+
+func (n *nodeSpan) overlaps(r LineRange) bool {
+	return n.startLine <= r.End && r.Start <= n.endLine
+}
+
+func (n *nodeSpan) encloses(r LineRange) bool {
+	return n.startLine <= r.Start && r.End <= n.endLine
+}
+
+func (n *nodeSpan) within(r LineRange) bool {
+	return r.Start <= n.startLine && n.endLine <= r.End
+}
+
+// cover appends to sel the smallest nodes under n that
+// need to be formatted so that all of r is formatted.
+// Nodes that are entirely in r are formatted as a whole,
+// so that their lines can be laid out again. Nodes that
+// formatting is turned off for are skipped.
+func (n *nodeSpan) cover(r LineRange, sel []*nodeSpan) []*nodeSpan {
+	for _, c := range n.children {
+		if !c.overlaps(r) || c.quiet {
+			continue
+		}
+		if c.encloses(r) && !c.within(r) && c.childOverlaps(r) {
+			sel = c.cover(r, sel)
+			continue
+		}
+		sel = append(sel, c)
+	}
+	return sel
+}
+
+func (n *nodeSpan) childOverlaps(r LineRange) bool {
+	for _, c := range n.children {
+		if c.overlaps(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// outermost sorts nodes by position and drops any node that is
+// nested inside of another one.
+func outermost(nodes []*nodeSpan) []*nodeSpan {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].start == nodes[j].start {
+			return nodes[i].end > nodes[j].end
+		}
+		return nodes[i].start < nodes[j].start
+	})
+	var res []*nodeSpan
+	for _, n := range nodes {
+		if len(res) > 0 && n.end <= res[len(res)-1].end {
+			continue
+		}
+		res = append(res, n)
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+package vugufmt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upperFormatter(f *Formatter) {
+	f.ScriptFormatters["upper"] = func(input []byte) ([]byte, *FmtError) {
+		return bytes.ToUpper(input), nil
+	}
+}
+
+func TestParseLineRanges(t *testing.T) {
+	ranges, err := ParseLineRanges("10:40, 52:60,7")
+	assert.NoError(t, err)
+	assert.Equal(t, []LineRange{{10, 40}, {52, 60}, {7, 7}}, ranges)
+
+	_, err = ParseLineRanges("40:10")
+	assert.Error(t, err)
+	_, err = ParseLineRanges("0:3")
+	assert.Error(t, err)
+	_, err = ParseLineRanges("a:b")
+	assert.Error(t, err)
+}
+
+func TestFormatRangeOnlyTouchesRange(t *testing.T) {
+	src := strings.Join([]string{
+		"<div>",
+		"<script type='upper'>",
+		"one",
+		"</script>",
+		"</div>",
+		"<script type='upper'>",
+		"two",
+		"</script>",
+		"",
+	}, "\n")
+	formatter := NewFormatter(upperFormatter)
+
+	res, err := formatter.FormatRange("", []byte(src), []LineRange{{3, 3}})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Replace(src, "one", "ONE", 1), string(res))
+
+	res, err = formatter.FormatRange("", []byte(src), []LineRange{{7, 7}})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Replace(src, "two", "TWO", 1), string(res))
+
+	// a range that spans both blocks expands to both of them.
+	res, err = formatter.FormatRange("", []byte(src), []LineRange{{4, 6}})
+	assert.Nil(t, err)
+	assert.Equal(t, strings.ToUpper(src), strings.ToUpper(string(res)))
+	assert.Contains(t, string(res), "ONE")
+	assert.Contains(t, string(res), "TWO")
+
+	// ranges that don't touch any element are a no-op.
+	res, err = formatter.FormatRange("", []byte(src), []LineRange{{9, 9}})
+	assert.Nil(t, err)
+	assert.Equal(t, src, string(res))
+}
+
+func TestFormatRangeErrorPosition(t *testing.T) {
+	src := "<div></div>\n\n<script type=\"application/x-go\">\nvar x := 1\n</script>\n"
+	formatter := NewFormatter(UseGoFmt(false))
+
+	_, err := formatter.FormatRange("", []byte(src), []LineRange{{4, 4}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 4, err.Line)
+
+	// the same error FormatHTML reports for the whole file.
+	var buf bytes.Buffer
+	whole := formatter.FormatHTML("", strings.NewReader(src), &buf)
+	assert.NotNil(t, whole)
+	assert.Equal(t, whole.Line, err.Line)
+}
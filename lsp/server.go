@@ -0,0 +1,267 @@
+// Package lsp is a Language Server Protocol server for vugu files.
+//
+// It speaks JSON-RPC over any reader and writer, usually stdin and
+// stdout, and supports whole document, range and on-type formatting.
+// Formatting errors are published as diagnostics whenever a document
+// is opened or changed.
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+
+	"github.com/erinpentecost/vugufmt"
+)
+
+// Server is a language server for vugu files.
+type Server struct {
+	formatter *vugufmt.Formatter
+	conn      *conn
+	// docs holds the text of every open document by URI.
+	docs     map[string]string
+	shutdown bool
+}
+
+// NewServer creates a server that formats with formatter.
+func NewServer(formatter *vugufmt.Formatter) *Server {
+	return &Server{
+		formatter: formatter,
+		docs:      make(map[string]string),
+	}
+}
+
+// Serve reads requests from r and writes replies to w until
+// the client sends exit, r is closed, or ctx is done.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if rerr, ok := err.(*rpcError); ok {
+			s.conn.reply(nil, nil, rerr)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(ctx, msg)
+		// notifications don't get a reply.
+		if msg.ID == nil {
+			continue
+		}
+		if err := s.conn.reply(msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle runs a single request or notification.
+func (s *Server) handle(ctx context.Context, msg *message) (interface{}, *rpcError) {
+	if s.shutdown && msg.ID != nil {
+		return nil, &rpcError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync: TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    1,
+				},
+				DocumentFormattingProvider:      true,
+				DocumentRangeFormattingProvider: true,
+				DocumentOnTypeFormattingProvider: DocumentOnTypeFormattingOptions{
+					FirstTriggerCharacter: ">",
+					MoreTriggerCharacter:  []string{"\n"},
+				},
+			},
+			ServerInfo: ServerInfo{Name: "vugufmt", Version: vugufmt.Version},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.docs[params.TextDocument.URI] = params.TextDocument.Text
+		s.publishDiagnostics(ctx, params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		// We only ask for full syncs, so the last change is the document.
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+		}
+		s.publishDiagnostics(ctx, params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.format(ctx, params.TextDocument.URI, nil, false)
+	case "textDocument/rangeFormatting":
+		var params DocumentRangeFormattingParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		end := params.Range.End.Line
+		// a selection that ends at the start of a line doesn't include it.
+		if params.Range.End.Character == 0 && end > params.Range.Start.Line {
+			end--
+		}
+		return s.format(ctx, params.TextDocument.URI, []vugufmt.LineRange{{
+			Start: params.Range.Start.Line + 1,
+			End:   end + 1,
+		}}, false)
+	case "textDocument/onTypeFormatting":
+		var params DocumentOnTypeFormattingParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		// After a newline, the line that was just finished
+		// is the one that needs formatting.
+		line := params.Position.Line + 1
+		start := line
+		if params.Ch == "\n" && start > 1 {
+			start--
+		}
+		return s.format(ctx, params.TextDocument.URI, []vugufmt.LineRange{{Start: start, End: line}}, true)
+	}
+
+	if msg.ID == nil {
+		// unknown notifications are ignored.
+		return nil, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+// format formats the document at uri, or only the
+// given ranges of it, and returns the edits. While the user is
+// typing, its tags often don't match up yet, so if onType is set,
+// that gets no edits rather than an error; the diagnostics
+// report it anyway.
+func (s *Server) format(ctx context.Context, uri string, ranges []vugufmt.LineRange, onType bool) (interface{}, *rpcError) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return nil, &rpcError{Code: codeRequestFailed, Message: "document is not open: " + uri}
+	}
+
+	var res []byte
+	var err *vugufmt.FmtError
+	if ranges == nil {
+		var buf bytes.Buffer
+		err = s.formatter.FormatHTMLContext(ctx, uriToPath(uri), bytes.NewReader([]byte(text)), &buf)
+		res = buf.Bytes()
+	} else {
+		res, err = s.formatter.FormatRangeContext(ctx, uriToPath(uri), []byte(text), ranges)
+	}
+	if err != nil {
+		if onType && structureError(err) {
+			return []TextEdit{}, nil
+		}
+		return nil, &rpcError{Code: codeRequestFailed, Message: err.Error()}
+	}
+
+	return computeEdits(text, string(res)), nil
+}
+
+// structureError reports whether err is about the
+// document's tags, rather than its scripts or styles.
+func structureError(err *vugufmt.FmtError) bool {
+	switch err.Code {
+	case vugufmt.CodeSyntax, vugufmt.CodeStrayEndTag, vugufmt.CodeMismatchedEndTag, vugufmt.CodeUnclosedTag:
+		return true
+	}
+	return false
+}
+
+// publishDiagnostics checks the document at uri and
+// sends whatever went wrong to the client.
+func (s *Server) publishDiagnostics(ctx context.Context, uri string) {
+	text := s.docs[uri]
+	diags := []Diagnostic{}
+	f := *s.formatter
+	f.Diagnostic = func(d *vugufmt.FmtError) {
+		diag := toDiagnostic(text, d)
+		diag.Severity = SeverityWarning
+		diags = append(diags, diag)
+	}
+	if err := f.FormatHTMLContext(ctx, uriToPath(uri), bytes.NewReader([]byte(text)), ioutil.Discard); err != nil {
+		diags = append(diags, toDiagnostic(text, err))
+	}
+	s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diags,
+	})
+}
+
+// toDiagnostic turns a formatting error into a diagnostic
+// that covers the rest of the line the error is on.
+func toDiagnostic(text string, err *vugufmt.FmtError) Diagnostic {
+	line := err.Line - 1
+	if line < 0 {
+		line = 0
+	}
+	col := err.Column - 1
+	if col < 0 {
+		col = 0
+	}
+	start := offsetOf(text, line, col)
+	end := lineEnd(text, start)
+	return Diagnostic{
+		Range:    Range{Start: position(text, start), End: position(text, end)},
+		Severity: SeverityError,
+		Code:     string(err.Code),
+		Source:   "vugufmt",
+		Message:  err.Msg,
+	}
+}
+
+func invalidParams(err error) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// uriToPath turns a file URI into a path for error messages.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
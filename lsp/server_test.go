@@ -0,0 +1,250 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/erinpentecost/vugufmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client is an in-process LSP client talking to a Server.
+type client struct {
+	t      *testing.T
+	conn   *conn
+	nextID int
+	// notifications collects everything the server sent
+	// that wasn't a reply.
+	notifications []*message
+	done          chan error
+}
+
+func newClient(t *testing.T, formatter *vugufmt.Formatter) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:    t,
+		conn: newConn(clientIn, clientOut),
+		done: make(chan error, 1),
+	}
+	go func() {
+		err := NewServer(formatter).Serve(context.Background(), serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// call sends a request and waits for its reply.
+func (c *client) call(method string, params, result interface{}) *rpcError {
+	c.nextID++
+	id := mustMarshal(c.t, c.nextID)
+	require.NoError(c.t, c.conn.write(&message{ID: &id, Method: method, Params: mustMarshal(c.t, params)}))
+
+	for {
+		msg, err := c.conn.read()
+		require.NoError(c.t, err)
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		require.Equal(c.t, string(id), string(*msg.ID))
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			require.NoError(c.t, json.Unmarshal(msg.Result, result))
+		}
+		return nil
+	}
+}
+
+// notify sends a notification.
+func (c *client) notify(method string, params interface{}) {
+	require.NoError(c.t, c.conn.notify(method, params))
+}
+
+// diagnostics waits for the next published diagnostics.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	var msg *message
+	if len(c.notifications) > 0 {
+		msg, c.notifications = c.notifications[0], c.notifications[1:]
+	} else {
+		var err error
+		msg, err = c.conn.read()
+		require.NoError(c.t, err)
+	}
+	require.Equal(c.t, "textDocument/publishDiagnostics", msg.Method)
+	var params PublishDiagnosticsParams
+	require.NoError(c.t, json.Unmarshal(msg.Params, &params))
+	return params
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	raw, err := json.Marshal(v)
+	require.NoError(t, err)
+	return raw
+}
+
+func upperFormatter(f *vugufmt.Formatter) {
+	f.ScriptFormatters["upper"] = func(input []byte) ([]byte, *vugufmt.FmtError) {
+		return []byte(strings.ToUpper(string(input))), nil
+	}
+}
+
+const testURI = "file:///tmp/root.vugu"
+
+const testDoc = "<div>\n<script type='upper'>\none\n</script>\n</div>\n<script type='upper'>\ntwo\n</script>\n"
+
+func TestServerLifecycle(t *testing.T) {
+	c := newClient(t, vugufmt.NewFormatter(upperFormatter))
+
+	var init InitializeResult
+	assert.Nil(t, c.call("initialize", map[string]interface{}{}, &init))
+	assert.True(t, init.Capabilities.DocumentFormattingProvider)
+	assert.True(t, init.Capabilities.DocumentRangeFormattingProvider)
+	assert.Equal(t, "vugufmt", init.ServerInfo.Name)
+	c.notify("initialized", struct{}{})
+
+	assert.Nil(t, c.call("shutdown", nil, nil))
+	rerr := c.call("textDocument/formatting", DocumentFormattingParams{}, nil)
+	assert.NotNil(t, rerr)
+	c.notify("exit", nil)
+	assert.NoError(t, <-c.done)
+}
+
+func TestServerFormatting(t *testing.T) {
+	c := newClient(t, vugufmt.NewFormatter(upperFormatter))
+	assert.Nil(t, c.call("initialize", map[string]interface{}{}, nil))
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "vugu", Text: testDoc},
+	})
+	assert.Empty(t, c.diagnostics().Diagnostics)
+
+	var edits []TextEdit
+	assert.Nil(t, c.call("textDocument/formatting", DocumentFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+	}, &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, Position{Line: 2, Character: 0}, edits[0].Range.Start)
+	assert.Equal(t, Position{Line: 6, Character: 3}, edits[0].Range.End)
+	assert.Equal(t, "ONE\n</script>\n</div>\n<script type='upper'>\nTWO", edits[0].NewText)
+
+	// only the second block is in range.
+	assert.Nil(t, c.call("textDocument/rangeFormatting", DocumentRangeFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Range:        Range{Start: Position{Line: 6}, End: Position{Line: 7}},
+	}, &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, Range{Start: Position{Line: 6}, End: Position{Line: 6, Character: 3}}, edits[0].Range)
+	assert.Equal(t, "TWO", edits[0].NewText)
+
+	// typing on the first block only formats that one.
+	assert.Nil(t, c.call("textDocument/onTypeFormatting", DocumentOnTypeFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: 3, Character: 9},
+		Ch:           ">",
+	}, &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, "ONE", edits[0].NewText)
+}
+
+func TestServerDiagnostics(t *testing.T) {
+	c := newClient(t, vugufmt.NewFormatter(vugufmt.UseGoFmt(false)))
+	assert.Nil(t, c.call("initialize", map[string]interface{}{}, nil))
+
+	bad := "<div></div>\n<script type=\"application/x-go\">\nvar x := 1\n</script>\n"
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "vugu", Text: bad},
+	})
+	diags := c.diagnostics().Diagnostics
+	require.Len(t, diags, 1)
+	assert.Equal(t, SeverityError, diags[0].Severity)
+	assert.Equal(t, 2, diags[0].Range.Start.Line)
+
+	// fixing the error clears it.
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{
+			{Text: strings.Replace(bad, ":=", "=", 1)},
+		},
+	})
+	assert.Empty(t, c.diagnostics().Diagnostics)
+
+	// mixed line endings are only a warning.
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{
+			{Text: "<div>\r\n<p>a</p>\r\n<p>b</p>\n</div>\r\n"},
+		},
+	})
+	diags = c.diagnostics().Diagnostics
+	require.Len(t, diags, 1)
+	assert.Equal(t, SeverityWarning, diags[0].Severity)
+	assert.Equal(t, 2, diags[0].Range.Start.Line)
+
+	var edits []TextEdit
+	rerr := c.call("textDocument/formatting", DocumentFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///not/open.vugu"},
+	}, &edits)
+	assert.NotNil(t, rerr)
+}
+
+func TestComputeEdits(t *testing.T) {
+	assert.Empty(t, computeEdits("same", "same"))
+
+	edits := computeEdits("héllo\nwörld\n", "héllo\nworld\n")
+	require.Len(t, edits, 1)
+	assert.Equal(t, Range{Start: Position{Line: 1, Character: 1}, End: Position{Line: 1, Character: 2}}, edits[0].Range)
+	assert.Equal(t, "o", edits[0].NewText)
+}
+
+func TestServerDiagnosticCode(t *testing.T) {
+	c := newClient(t, vugufmt.NewFormatter())
+	assert.Nil(t, c.call("initialize", map[string]interface{}{}, nil))
+
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "vugu", Text: "</div>\n"},
+	})
+	diags := c.diagnostics().Diagnostics
+	require.Len(t, diags, 1)
+	assert.Equal(t, "stray-end-tag", diags[0].Code)
+}
+
+func TestServerOnTypeBroken(t *testing.T) {
+	c := newClient(t, vugufmt.NewFormatter())
+	assert.Nil(t, c.call("initialize", map[string]interface{}{}, nil))
+
+	// the <p> is still being typed.
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "vugu", Text: "<div>\n<p>\n</div>\n"},
+	})
+	assert.NotEmpty(t, c.diagnostics().Diagnostics)
+
+	edits := []TextEdit{{NewText: "x"}}
+	assert.Nil(t, c.call("textDocument/onTypeFormatting", DocumentOnTypeFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: 2, Character: 0},
+		Ch:           "\n",
+	}, &edits))
+	assert.Empty(t, edits)
+
+	// explicit formatting still fails.
+	assert.NotNil(t, c.call("textDocument/formatting", DocumentFormattingParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+	}, nil))
+}
+
+func TestServerParseError(t *testing.T) {
+	var out strings.Builder
+	in := strings.NewReader("Content-Length: 5\r\n\r\n{bad}")
+	require.NoError(t, NewServer(vugufmt.NewFormatter()).Serve(context.Background(), in, &out))
+	assert.Contains(t, out.String(), `"id":null`)
+	assert.Contains(t, out.String(), `"code":-32700`)
+}
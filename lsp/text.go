@@ -0,0 +1,80 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// offsetOf returns the byte offset of the given zero-based
+// line and byte column, clamped to the end of that line.
+func offsetOf(text string, line, col int) int {
+	offset := 0
+	for i := 0; i < line; i++ {
+		nl := strings.IndexByte(text[offset:], '\n')
+		if nl < 0 {
+			return len(text)
+		}
+		offset += nl + 1
+	}
+	end := lineEnd(text, offset)
+	if offset+col > end {
+		return end
+	}
+	return offset + col
+}
+
+// lineEnd returns the offset of the newline that ends
+// the line containing offset, or len(text).
+func lineEnd(text string, offset int) int {
+	if nl := strings.IndexByte(text[offset:], '\n'); nl >= 0 {
+		return offset + nl
+	}
+	return len(text)
+}
+
+// position converts a byte offset into an LSP position,
+// which counts characters in UTF-16 code units.
+func position(text string, offset int) Position {
+	line := strings.Count(text[:offset], "\n")
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	char := 0
+	for _, r := range text[lineStart:offset] {
+		char += len(utf16.Encode([]rune{r}))
+	}
+	return Position{Line: line, Character: char}
+}
+
+// computeEdits returns a single edit that turns before into after,
+// covering only the part in between their common prefix and suffix.
+func computeEdits(before, after string) []TextEdit {
+	if before == after {
+		return []TextEdit{}
+	}
+
+	prefix := 0
+	for prefix < len(before) && prefix < len(after) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	// don't split a rune
+	for prefix > 0 && prefix < len(before) && !utf8.RuneStart(before[prefix]) {
+		prefix--
+	}
+
+	suffix := 0
+	for suffix < len(before)-prefix && suffix < len(after)-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && !utf8.RuneStart(before[len(before)-suffix]) {
+		suffix--
+	}
+
+	return []TextEdit{{
+		Range: Range{
+			Start: position(before, prefix),
+			End:   position(before, len(before)-suffix),
+		},
+		NewText: after[prefix : len(after)-suffix],
+	}}
+}
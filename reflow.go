@@ -0,0 +1,122 @@
+package vugufmt
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/erinpentecost/vugufmt/internal/pretty"
+)
+
+// UseReflow sets whether text and comments are wrapped to fit in the
+// formatter's MaxWidth. It does nothing unless MaxWidth is set too.
+func UseReflow(reflow bool) func(*Formatter) {
+	return func(f *Formatter) {
+		f.Reflow = reflow
+	}
+}
+
+// commentMarker starts comments that tell vugufmt what to do.
+// They are never reflowed.
+const commentMarker = "vugufmt:"
+
+// layoutComment lays out a comment. If Reflow is set, its words are
+// wrapped to fit. A comment that spans several lines keeps doing so,
+// with the indentation its lines had, and one that doesn't is only
+// broken up if it doesn't fit on its line.
+func (f *Formatter) layoutComment(raw []byte) pretty.Doc {
+	s := string(raw)
+	if !f.Reflow || len(s) < len("<!---->") {
+		return pretty.Text(s)
+	}
+	body := s[len("<!--") : len(s)-len("-->")]
+	if trimmed := strings.TrimSpace(body); trimmed == "" || strings.HasPrefix(trimmed, commentMarker) {
+		return pretty.Text(s)
+	}
+
+	lines := strings.Split(body, "\n")
+	var paragraphs []pretty.Doc
+	var words []string
+	for i, line := range lines {
+		fields := strings.FieldsFunc(line, isSpaceRune)
+		words = append(words, fields...)
+		if (len(fields) == 0 || i == len(lines)-1) && len(words) > 0 {
+			paragraphs = append(paragraphs, fillWords(words))
+			words = nil
+		}
+	}
+
+	open, close := pretty.Line(), pretty.Line()
+	extra := f.indent()
+	if len(lines) > 1 {
+		open, close = pretty.HardLine(), pretty.HardLine()
+		// The words are indented as much as they were compared
+		// to the end of the comment, if that's on its own line.
+		last := lines[len(lines)-1]
+		common := commonIndent(lines[1 : len(lines)-1])
+		if strings.TrimLeft(last, " \t") == "" && strings.HasPrefix(common, last) {
+			extra = common[len(last):]
+		}
+	} else {
+		if !isSpace(body[0]) {
+			open = pretty.SoftLine()
+		}
+		if !isSpace(body[len(body)-1]) {
+			close = pretty.SoftLine()
+		}
+	}
+
+	var inner []pretty.Doc
+	for i, p := range paragraphs {
+		if i > 0 {
+			inner = append(inner, pretty.HardLine(), pretty.HardLine())
+		}
+		inner = append(inner, p)
+	}
+	wrapped := pretty.Concat(open, pretty.Concat(inner...))
+	if extra != "" {
+		wrapped = pretty.Align(extra, wrapped)
+	}
+	return pretty.Group(pretty.Concat(pretty.Text("<!--"), wrapped, close, pretty.Text("-->")))
+}
+
+// fillWords lays out words like a paragraph.
+func fillWords(words []string) pretty.Doc {
+	var docs []pretty.Doc
+	for i, w := range words {
+		if i > 0 {
+			docs = append(docs, pretty.Line())
+		}
+		docs = append(docs, pretty.Text(w))
+	}
+	return pretty.Fill(docs...)
+}
+
+// commonIndent is the leading whitespace that all
+// the lines that aren't blank have in common.
+func commonIndent(lines []string) string {
+	common := ""
+	found := false
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		indent := line[:len(line)-len(trimmed)]
+		if !found {
+			common, found = indent, true
+			continue
+		}
+		i := 0
+		for i < len(common) && i < len(indent) && common[i] == indent[i] {
+			i++
+		}
+		common = common[:i]
+	}
+	return common
+}
+
+// isSpaceRune is isSpace for runes. Other kinds of space,
+// like non-breaking ones, are part of words.
+func isSpaceRune(r rune) bool {
+	return r < utf8.RuneSelf && isSpace(byte(r))
+}
@@ -0,0 +1,58 @@
+package vugufmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReflowText(t *testing.T) {
+	src := "<p>This is a rather long paragraph of text that was typed without any care\n" +
+		"for the width, with an&nbsp;entity and <b>some bold text</b> in it.</p>"
+
+	// without reflow, text is only broken next to elements.
+	formatter := NewFormatter(UseMaxWidth(50))
+	assert.Equal(t,
+		"<p>This is a rather long paragraph of text that was typed without any care\n"+
+			"    for the width, with an&nbsp;entity and\n"+
+			"    <b>some bold text</b> in it.</p>",
+		formatString(t, formatter, src))
+
+	formatter = NewFormatter(UseMaxWidth(50), UseReflow(true))
+	res := formatString(t, formatter, src)
+	assert.Equal(t,
+		"<p>This is a rather long paragraph of text that\n"+
+			"    was typed without any care for the width, with\n"+
+			"    an&nbsp;entity and <b>some bold text</b> in\n"+
+			"    it.</p>",
+		res)
+	assert.Equal(t, res, formatString(t, formatter, res))
+	assert.Equal(t, rendered(src, allInline), rendered(res, allInline))
+
+	// line breaks between elements stay where they are.
+	src = "<ul>\n    <li>one</li>\n    <li>two</li>\n</ul>"
+	assert.Equal(t, src, formatString(t, formatter, src))
+}
+
+func TestReflowComments(t *testing.T) {
+	formatter := NewFormatter(UseMaxWidth(40), UseReflow(true))
+
+	assert.Equal(t,
+		"<div>\n    <!-- short -->\n</div>",
+		formatString(t, formatter, "<div>\n<!--   short -->\n</div>"))
+
+	res := formatString(t, formatter, "<div>\n<!-- a single line comment that is too long for its line -->\n</div>")
+	assert.Equal(t,
+		"<div>\n    <!--\n        a single line comment that is\n        too long for its line\n    -->\n</div>",
+		res)
+	assert.Equal(t, res, formatString(t, formatter, res))
+
+	// comment blocks keep their indentation and paragraphs.
+	src := "<div>\n    <!--\n      An indented comment block\n      with two lines.\n\n      And a second paragraph.\n    -->\n</div>"
+	assert.Equal(t,
+		"<div>\n    <!--\n      An indented comment block with two\n      lines.\n\n      And a second paragraph.\n    -->\n</div>",
+		formatString(t, formatter, src))
+
+	src = "<div>\n    <!-- vugufmt:off this comment is long, but it's a marker so it stays -->\n</div>"
+	assert.Equal(t, src, formatString(t, formatter, src))
+}
@@ -0,0 +1,72 @@
+package vugufmt
+
+import (
+	"context"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// ScriptRequest is a script block for a ScriptFormatter to format.
+type ScriptRequest struct {
+	// Filename is the name of the file the block is in.
+	// It is empty if the file doesn't have one.
+	Filename string
+	// Type is the block's type attribute, in lower case.
+	Type string
+	// Tag is the block's <script> start tag.
+	Tag htmlx.Token
+	// Src is the text of the block.
+	Src []byte
+	// Indent is the indentation of the line that Tag is on.
+	Indent string
+	// Region is where Src is in the file.
+	Region srcmap.Region
+}
+
+// ScriptResult is a formatted script block.
+type ScriptResult struct {
+	// Src is the formatted text of the block.
+	Src []byte
+}
+
+// ScriptFormatter formats script blocks. The Line and Column of a
+// *FmtError that it returns count from the start of req.Src, and are
+// moved to where that is in the file. Other errors are reported at
+// the start of the block.
+type ScriptFormatter interface {
+	Format(ctx context.Context, req ScriptRequest) (ScriptResult, error)
+}
+
+// ScriptFunc is a ScriptFormatter that only needs the text of a block.
+type ScriptFunc func([]byte) ([]byte, *FmtError)
+
+// Format calls fn with req.Src.
+func (fn ScriptFunc) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	res, err := fn(req.Src)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+	return ScriptResult{Src: res}, nil
+}
+
+// scriptError is err, from a ScriptFormatter, as a *FmtError.
+func scriptError(err error) *FmtError {
+	switch err := err.(type) {
+	case *FmtError:
+		return err
+	case FmtError:
+		return &err
+	}
+	return &FmtError{Msg: err.Error()}
+}
+
+// leadingSpace is the indentation at the start of line.
+func leadingSpace(line []byte) []byte {
+	for i, c := range line {
+		if c != ' ' && c != '\t' {
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,116 @@
+package vugufmt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/erinpentecost/vugufmt/srcmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a ScriptFormatter that keeps the requests it gets.
+type recorder struct {
+	reqs []ScriptRequest
+	err  error
+}
+
+func (r *recorder) Format(ctx context.Context, req ScriptRequest) (ScriptResult, error) {
+	r.reqs = append(r.reqs, req)
+	return ScriptResult{Src: req.Src}, r.err
+}
+
+func TestScriptRequest(t *testing.T) {
+	rec := &recorder{}
+	formatter := NewFormatter()
+	formatter.Scripts["text/x"] = rec
+
+	src := "<div>\n\t<script Type=\"TEXT/X\" id=\"a\">one\ntwo</script>\n</div>\n"
+	assert.Equal(t, src, formatString(t, formatter, src))
+	require.Len(t, rec.reqs, 1)
+	req := rec.reqs[0]
+	assert.Equal(t, "text/x", req.Type)
+	assert.Equal(t, "script", req.Tag.Data)
+	assert.Equal(t, "a", attr(req.Tag, "id"))
+	assert.Equal(t, "one\ntwo", string(req.Src))
+	assert.Equal(t, "\t", req.Indent)
+	assert.Equal(t, srcmap.Position{Offset: 36, Line: 2, Column: 31}, req.Region.Start)
+	assert.Equal(t, srcmap.Position{Offset: 43, Line: 3, Column: 4}, req.Region.End)
+
+	// blocks in a range are where they are in the whole file.
+	rec.reqs = nil
+	_, err := formatter.FormatRange("x.vugu", []byte("<p>a</p>\n"+src), []LineRange{{Start: 3, End: 3}})
+	require.Nil(t, err)
+	require.Len(t, rec.reqs, 1)
+	assert.Equal(t, "x.vugu", rec.reqs[0].Filename)
+	assert.Equal(t, "\t", rec.reqs[0].Indent)
+	assert.Equal(t, srcmap.Position{Offset: 45, Line: 3, Column: 31}, rec.reqs[0].Region.Start)
+}
+
+func TestScriptsPrecedence(t *testing.T) {
+	formatter := NewFormatter()
+	formatter.ScriptFormatters["text/x"] = func(input []byte) ([]byte, *FmtError) {
+		return bytes.ToUpper(input), nil
+	}
+	src := "<script type=\"text/x\">a</script>"
+	assert.Equal(t, "<script type=\"text/x\">A</script>", formatString(t, formatter, src))
+
+	rec := &recorder{}
+	formatter.Scripts["text/x"] = rec
+	assert.Equal(t, src, formatString(t, formatter, src))
+	assert.Len(t, rec.reqs, 1)
+}
+
+func TestScriptFormatterErrors(t *testing.T) {
+	rec := &recorder{err: errors.New("no good")}
+	formatter := NewFormatter()
+	formatter.Scripts["text/x"] = rec
+
+	src := "<div>\n  <script type=\"text/x\">a</script>\n</div>\n"
+	var buf bytes.Buffer
+	err := formatter.FormatHTML("x.vugu", strings.NewReader(src), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:2:25: no good", err.Error())
+
+	rec.err = &FmtError{Msg: "bad", Line: 1, Column: 1}
+	err = formatter.FormatHTML("x.vugu", strings.NewReader(src), &buf)
+	require.NotNil(t, err)
+	assert.Equal(t, "x.vugu:2:25: bad", err.Error())
+}
+
+func TestFormatHTMLContextCanceled(t *testing.T) {
+	rec := &recorder{}
+	formatter := NewFormatter()
+	formatter.Scripts["text/x"] = rec
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	err := formatter.FormatHTMLContext(ctx, "x.vugu", strings.NewReader("<script type=\"text/x\">a</script>\n"), &buf)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "canceled")
+	assert.Empty(t, rec.reqs)
+}
+
+func TestFormatRangeContextCanceled(t *testing.T) {
+	rec := &recorder{}
+	formatter := NewFormatter()
+	formatter.Scripts["text/x"] = rec
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	src := "<div>\n<script type=\"text/x\">a</script>\n</div>\n"
+	_, err := formatter.FormatRangeContext(ctx, "x.vugu", []byte(src), []LineRange{{Start: 2, End: 2}})
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "canceled")
+	assert.Empty(t, rec.reqs)
+
+	_, derr := formatter.DiffRangeContext(ctx, "x.vugu", strings.NewReader(src), []LineRange{{Start: 2, End: 2}}, ioutil.Discard)
+	assert.NotNil(t, derr)
+	_, derr = formatter.DiffContext(ctx, "x.vugu", strings.NewReader(src), ioutil.Discard)
+	assert.NotNil(t, derr)
+}
@@ -0,0 +1,136 @@
+package vugufmt
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+)
+
+// simplify makes the same changes to file that gofmt -s does, following
+// cmd/gofmt's simplify.go, so Verify doesn't need gofmt to tell them
+// apart from changes to the code.
+func simplify(file *ast.File) {
+	removeEmptyDeclGroups(file)
+	ast.Walk(simplifier{}, file)
+}
+
+type simplifier struct{}
+
+func (s simplifier) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.CompositeLit:
+		// array, slice and map literals can leave out
+		// the types of their elements and keys.
+		var keyType, eltType ast.Expr
+		switch typ := n.Type.(type) {
+		case *ast.ArrayType:
+			eltType = typ.Elt
+		case *ast.MapType:
+			keyType = typ.Key
+			eltType = typ.Value
+		}
+		if eltType == nil {
+			break
+		}
+		for i, x := range n.Elts {
+			px := &n.Elts[i]
+			if kv, ok := x.(*ast.KeyValueExpr); ok {
+				if keyType != nil {
+					s.simplifyLiteral(keyType, kv.Key, &kv.Key)
+				}
+				x, px = kv.Value, &kv.Value
+			}
+			s.simplifyLiteral(eltType, x, px)
+		}
+		// the elements were walked by simplifyLiteral.
+		return nil
+
+	case *ast.SliceExpr:
+		// s[a:len(s)] becomes s[a:], if s is an identifier.
+		if n.Max != nil {
+			break
+		}
+		if x, ok := n.X.(*ast.Ident); ok {
+			if call, ok := n.High.(*ast.CallExpr); ok && len(call.Args) == 1 && !call.Ellipsis.IsValid() {
+				if fun, ok := call.Fun.(*ast.Ident); ok && fun.Name == "len" {
+					if arg, ok := call.Args[0].(*ast.Ident); ok && arg.Name == x.Name {
+						n.High = nil
+					}
+				}
+			}
+		}
+
+	case *ast.RangeStmt:
+		// for x, _ = range v becomes for x = range v,
+		// and for _ = range v becomes for range v.
+		if isBlank(n.Value) {
+			n.Value = nil
+		}
+		if isBlank(n.Key) && n.Value == nil {
+			n.Key = nil
+		}
+	}
+	return s
+}
+
+// simplifyLiteral simplifies x, an element or key of a composite
+// literal whose elements or keys have type typ, and stored at px.
+func (s simplifier) simplifyLiteral(typ, x ast.Expr, px *ast.Expr) {
+	ast.Walk(s, x)
+
+	// T{...} can leave out T.
+	if inner, ok := x.(*ast.CompositeLit); ok && sameExpr(typ, inner.Type) {
+		inner.Type = nil
+	}
+	// &T{...} can leave out &T when the type is *T.
+	if ptr, ok := typ.(*ast.StarExpr); ok {
+		if addr, ok := x.(*ast.UnaryExpr); ok && addr.Op == token.AND {
+			if inner, ok := addr.X.(*ast.CompositeLit); ok && sameExpr(ptr.X, inner.Type) {
+				inner.Type = nil
+				*px = inner
+			}
+		}
+	}
+}
+
+// sameExpr reports whether a and b are the same
+// expression, wherever they are.
+func sameExpr(a, b ast.Expr) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	var bufA, bufB bytes.Buffer
+	if printTree(&bufA, a) != nil || printTree(&bufB, b) != nil {
+		return false
+	}
+	return bufA.String() == bufB.String()
+}
+
+func isBlank(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// removeEmptyDeclGroups removes declarations like "const ()"
+// that have no specs, doc comment or comments inside them.
+func removeEmptyDeclGroups(file *ast.File) {
+	decls := file.Decls[:0]
+	for _, d := range file.Decls {
+		if gen, ok := d.(*ast.GenDecl); !ok || !emptyDecl(file, gen) {
+			decls = append(decls, d)
+		}
+	}
+	file.Decls = decls
+}
+
+func emptyDecl(file *ast.File, gen *ast.GenDecl) bool {
+	if gen.Doc != nil || gen.Specs != nil {
+		return false
+	}
+	for _, c := range file.Comments {
+		if gen.Pos() <= c.Pos() && c.End() <= gen.End() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+// Package srcmap maps positions in text that is embedded in a file, like
+// the Go code of an x-go block or the CSS of a style block, to positions
+// in the file, and back again.
+//
+// Errors from the formatters of embedded languages are relative to the
+// text they were given. A Region knows where that text starts, so that
+// the errors can be reported where they are in the file.
+package srcmap
+
+// Position is a place in some text. Offset counts bytes from 0. Line and
+// Column count from 1, and Column counts bytes, the way go/token's do,
+// so a tab is one column. A Line of 0 means the position isn't known.
+type Position struct {
+	Offset, Line, Column int
+}
+
+// IsValid reports whether p is a known position.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// before reports whether p comes before q.
+func (p Position) before(q Position) bool {
+	return p.Line < q.Line || p.Line == q.Line && p.Column < q.Column
+}
+
+// Region is where some embedded text is in its host file.
+type Region struct {
+	// Start is where the text starts in the host file,
+	// and End is where it ends.
+	Start, End Position
+}
+
+// New returns the Region of text, which starts at start in its host
+// file. Line breaks are \n, which covers \r\n too.
+func New(start Position, text []byte) Region {
+	end := start
+	end.Offset += len(text)
+	for _, c := range text {
+		if c == '\n' {
+			end.Line++
+			end.Column = 1
+		} else {
+			end.Column++
+		}
+	}
+	return Region{Start: start, End: end}
+}
+
+// ToHost returns where p, a position in the embedded text, is in the host
+// file. Only the first line of the text is shifted by the column it starts
+// on. A position that isn't known is taken to be the start of the region.
+func (r Region) ToHost(p Position) Position {
+	if !p.IsValid() {
+		return r.Start
+	}
+	h := Position{
+		Offset: r.Start.Offset + p.Offset,
+		Line:   r.Start.Line + p.Line - 1,
+		Column: p.Column,
+	}
+	if p.Line == 1 {
+		h.Column += r.Start.Column - 1
+	}
+	return h
+}
+
+// FromHost returns where p, a position in the host file, is in the
+// embedded text. ok is false if p isn't in the region.
+func (r Region) FromHost(p Position) (e Position, ok bool) {
+	if !p.IsValid() || p.before(r.Start) || r.End.before(p) {
+		return Position{}, false
+	}
+	e = Position{
+		Offset: p.Offset - r.Start.Offset,
+		Line:   p.Line - r.Start.Line + 1,
+		Column: p.Column,
+	}
+	if e.Line == 1 {
+		e.Column -= r.Start.Column - 1
+	}
+	return e, true
+}
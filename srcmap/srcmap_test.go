@@ -0,0 +1,66 @@
+package srcmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirstLine(t *testing.T) {
+	// <script type="application/x-go">var x = 1
+	// func f() {}</script>
+	r := New(Position{Offset: 32, Line: 3, Column: 33}, []byte("var x = 1\nfunc f() {}"))
+
+	assert.Equal(t, Position{Offset: 36, Line: 3, Column: 37}, r.ToHost(Position{Offset: 4, Line: 1, Column: 5}))
+	assert.Equal(t, Position{Offset: 47, Line: 4, Column: 6}, r.ToHost(Position{Offset: 15, Line: 2, Column: 6}))
+	assert.Equal(t, Position{Offset: 53, Line: 4, Column: 12}, r.End)
+
+	e, ok := r.FromHost(Position{Offset: 36, Line: 3, Column: 37})
+	assert.True(t, ok)
+	assert.Equal(t, Position{Offset: 4, Line: 1, Column: 5}, e)
+	e, ok = r.FromHost(Position{Offset: 47, Line: 4, Column: 6})
+	assert.True(t, ok)
+	assert.Equal(t, Position{Offset: 15, Line: 2, Column: 6}, e)
+}
+
+func TestUnknownPosition(t *testing.T) {
+	r := New(Position{Offset: 10, Line: 2, Column: 8}, []byte("a {}"))
+	assert.Equal(t, r.Start, r.ToHost(Position{}))
+	_, ok := r.FromHost(Position{})
+	assert.False(t, ok)
+}
+
+func TestOutside(t *testing.T) {
+	r := New(Position{Offset: 10, Line: 2, Column: 8}, []byte("a\nb"))
+	for _, p := range []Position{
+		{Offset: 9, Line: 2, Column: 7},
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 14, Line: 3, Column: 3},
+		{Offset: 20, Line: 4, Column: 1},
+	} {
+		_, ok := r.FromHost(p)
+		assert.False(t, ok, "%+v", p)
+	}
+	_, ok := r.FromHost(Position{Offset: 13, Line: 3, Column: 2})
+	assert.True(t, ok, "the end of the region is in it")
+}
+
+func TestCRLF(t *testing.T) {
+	// the \r is the last column of its line,
+	// so it doesn't move anything after it.
+	r := New(Position{Offset: 7, Line: 1, Column: 8}, []byte("a {\r\n  color: red;\r\n}"))
+	assert.Equal(t, Position{Offset: 28, Line: 3, Column: 2}, r.End)
+	assert.Equal(t, Position{Offset: 14, Line: 2, Column: 3}, r.ToHost(Position{Offset: 7, Line: 2, Column: 3}))
+
+	e, ok := r.FromHost(Position{Offset: 14, Line: 2, Column: 3})
+	assert.True(t, ok)
+	assert.Equal(t, Position{Offset: 7, Line: 2, Column: 3}, e)
+}
+
+func TestTabs(t *testing.T) {
+	// a tab is one column, however wide it's shown.
+	r := New(Position{Offset: 5, Line: 1, Column: 6}, []byte("\tx := 1\n\t\ty"))
+	assert.Equal(t, Position{Offset: 6, Line: 1, Column: 7}, r.ToHost(Position{Offset: 1, Line: 1, Column: 2}))
+	assert.Equal(t, Position{Offset: 16, Line: 2, Column: 3}, r.ToHost(Position{Offset: 11, Line: 2, Column: 3}))
+	assert.Equal(t, Position{Offset: 16, Line: 2, Column: 4}, r.End)
+}
@@ -0,0 +1,187 @@
+package vugufmt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+)
+
+// Markers that turn formatting off for part of a file. In HTML they go
+// in comments, like <!-- vugufmt:off -->, and in x-go blocks they go in
+// line comments, like // vugufmt:off.
+const (
+	markerOff        = "vugufmt:off"
+	markerOn         = "vugufmt:on"
+	markerIgnoreNext = "vugufmt:ignore-next"
+)
+
+// htmlMarker returns the marker in a raw HTML comment,
+// or "" if it isn't one.
+func htmlMarker(raw []byte) string {
+	if !bytes.HasPrefix(raw, []byte("<!--")) || !bytes.HasSuffix(raw, []byte("-->")) || len(raw) < len("<!---->") {
+		return ""
+	}
+	switch m := string(bytes.TrimSpace(raw[len("<!--") : len(raw)-len("-->")])); m {
+	case markerOff, markerOn, markerIgnoreNext:
+		return m
+	}
+	return ""
+}
+
+// suppression keeps track of which tokens are in a part of
+// the document that mustn't be formatted.
+//
+// A vugufmt:off region lasts until a vugufmt:on marker with the same
+// parent, or until its parent ends. vugufmt:ignore-next covers the
+// next element, text or comment, but not the whitespace before it.
+type suppression struct {
+	// offDepth is the depth of the stack where formatting was
+	// turned off, or -1.
+	offDepth int
+	// ignoreNext is set right after a vugufmt:ignore-next marker.
+	ignoreNext bool
+	// ignoreDepth is the depth of the stack outside of the
+	// element that is being ignored, or -1.
+	ignoreDepth int
+}
+
+func newSuppression() *suppression {
+	return &suppression{offDepth: -1, ignoreDepth: -1}
+}
+
+// quiet reports whether a token must be left as it is. depth is the
+// depth of the stack after the token, so it includes start tags and
+// doesn't include end tags.
+func (s *suppression) quiet(tt htmlx.TokenType, raw []byte, depth int) bool {
+	switch {
+	case s.offDepth >= 0:
+		if tt == htmlx.EndTagToken && depth < s.offDepth {
+			s.offDepth = -1
+			return false
+		}
+		if tt == htmlx.CommentToken && depth == s.offDepth && htmlMarker(raw) == markerOn {
+			s.offDepth = -1
+			return false
+		}
+		return true
+	case s.ignoreDepth >= 0:
+		if tt == htmlx.EndTagToken && depth == s.ignoreDepth {
+			s.ignoreDepth = -1
+		}
+		return true
+	case s.ignoreNext:
+		switch {
+		case tt == htmlx.TextToken && len(bytes.TrimSpace(raw)) == 0:
+			return false
+		case tt == htmlx.EndTagToken:
+			// there's nothing left to ignore.
+			s.ignoreNext = false
+			return false
+		}
+		s.ignoreNext = false
+		if tt == htmlx.StartTagToken {
+			s.ignoreDepth = depth - 1
+		}
+		return true
+	}
+
+	if tt == htmlx.CommentToken {
+		switch htmlMarker(raw) {
+		case markerOff:
+			s.offDepth = depth
+		case markerIgnoreNext:
+			s.ignoreNext = true
+		}
+	}
+	return false
+}
+
+// goScriptType is the type of x-go script blocks.
+const goScriptType = "application/x-go"
+
+// goPlaceholder stands in for each line of a suppressed part of an
+// x-go block while it is being formatted.
+const goPlaceholder = "// vugufmt:suppressed "
+
+// maskGo replaces every line of each vugufmt:off region of Go source
+// with a placeholder line, so that the lines of the source stay where
+// they are, and returns the regions that were replaced.
+func maskGo(src []byte) (masked []byte, regions [][]byte) {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	var buf bytes.Buffer
+	for i := 0; i < len(lines); i++ {
+		buf.Write(lines[i])
+		if string(bytes.TrimSpace(lines[i])) != "// "+markerOff {
+			continue
+		}
+
+		start := i + 1
+		end := start
+		for end < len(lines) && string(bytes.TrimSpace(lines[end])) != "// "+markerOn {
+			end++
+		}
+		if end == start {
+			continue
+		}
+		for _, line := range lines[start:end] {
+			// the last of lines is empty if src ends in a line break.
+			if len(line) > 0 {
+				fmt.Fprintf(&buf, "%s%d\n", goPlaceholder, len(regions))
+			}
+		}
+		regions = append(regions, bytes.Join(lines[start:end], nil))
+		i = end - 1
+	}
+	return buf.Bytes(), regions
+}
+
+// unmaskGo puts the regions that maskGo took out back into
+// formatted source. It reports false if any of them went missing.
+func unmaskGo(src []byte, regions [][]byte) ([]byte, bool) {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	var buf bytes.Buffer
+	found := 0
+	last := -1
+	for _, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if !bytes.HasPrefix(trimmed, []byte(goPlaceholder)) {
+			buf.Write(line)
+			last = -1
+			continue
+		}
+		i, err := strconv.Atoi(string(trimmed[len(goPlaceholder):]))
+		if err != nil || i < 0 || i >= len(regions) {
+			buf.Write(line)
+			last = -1
+			continue
+		}
+		// the rest of the region's lines are the same.
+		if i != last {
+			buf.Write(regions[i])
+			found++
+		}
+		last = i
+	}
+	return buf.Bytes(), found == len(regions)
+}
+
+// formatGo runs an x-go block through fn, leaving
+// its vugufmt:off regions as they are.
+func formatGo(fn func([]byte) ([]byte, *FmtError), src []byte) ([]byte, *FmtError) {
+	masked, regions := maskGo(src)
+	if len(regions) == 0 {
+		return fn(src)
+	}
+
+	res, err := fn(masked)
+	if err != nil {
+		return src, err
+	}
+	res, ok := unmaskGo(res, regions)
+	if !ok {
+		return src, &FmtError{Msg: "a vugufmt:off region was lost while formatting"}
+	}
+	return res, nil
+}
@@ -0,0 +1,168 @@
+package vugufmt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuppressOffOn(t *testing.T) {
+	formatter := NewFormatter(upperFormatter, UseAttributeOptions(AttributeOptions{Quote: '"'}))
+	src := "<div class='a'>\n" +
+		"<!-- vugufmt:off -->\n" +
+		"<p class='b'>  hand   aligned </p>\n" +
+		"<script type='upper'>left alone</script>\n" +
+		"<!-- vugufmt:on -->\n" +
+		"<p class='c'></p>\n" +
+		"</div>"
+	assert.Equal(t,
+		"<div class=\"a\">\n"+
+			"<!-- vugufmt:off -->\n"+
+			"<p class='b'>  hand   aligned </p>\n"+
+			"<script type='upper'>left alone</script>\n"+
+			"<!-- vugufmt:on -->\n"+
+			"<p class=\"c\"></p>\n"+
+			"</div>",
+		formatString(t, formatter, src))
+
+	// a region ends with its parent, and a vugufmt:on
+	// inside of an element doesn't end it early.
+	src = "<div>\n<!-- vugufmt:off -->\n<p class='b'><!-- vugufmt:on --></p>\n</div>\n<p class='c'></p>"
+	assert.Equal(t,
+		"<div>\n<!-- vugufmt:off -->\n<p class='b'><!-- vugufmt:on --></p>\n</div>\n<p class=\"c\"></p>",
+		formatString(t, formatter, src))
+}
+
+func TestSuppressLayout(t *testing.T) {
+	formatter := NewFormatter(UseMaxWidth(20))
+	src := "<section>\n" +
+		"<!-- vugufmt:off -->\n" +
+		"<table>\n" +
+		"  <tr><td>1</td>   <td>22</td></tr>\n" +
+		"  <tr><td>333</td> <td>4</td></tr>\n" +
+		"</table>\n" +
+		"<!-- vugufmt:on -->\n" +
+		"<p>some text <b>that is laid out</b></p>\n" +
+		"</section>"
+	assert.Equal(t,
+		"<section>\n"+
+			"    <!-- vugufmt:off -->\n"+
+			"<table>\n"+
+			"  <tr><td>1</td>   <td>22</td></tr>\n"+
+			"  <tr><td>333</td> <td>4</td></tr>\n"+
+			"</table>\n"+
+			"<!-- vugufmt:on -->\n"+
+			"    <p>some text\n"+
+			"        <b>that is laid out</b></p>\n"+
+			"</section>",
+		formatString(t, formatter, src))
+}
+
+func TestSuppressIgnoreNext(t *testing.T) {
+	formatter := NewFormatter(UseMaxWidth(20))
+	src := "<div>\n" +
+		"<!-- vugufmt:ignore-next -->\n" +
+		"<pre class='art'> /\\_/\\ </pre> <p>some text <b>that is laid out</b></p>\n" +
+		"</div>"
+	assert.Equal(t,
+		"<div>\n"+
+			"    <!-- vugufmt:ignore-next -->\n"+
+			"    <pre class='art'> /\\_/\\ </pre>\n"+
+			"    <p>some text\n"+
+			"        <b>that is laid out</b></p>\n"+
+			"</div>",
+		formatString(t, formatter, src))
+
+	// there's nothing to ignore before the end of the parent.
+	src = "<div><!-- vugufmt:ignore-next --></div><p class='a'></p>"
+	assert.Equal(t,
+		"<div><!-- vugufmt:ignore-next --></div><p class=\"a\"></p>",
+		formatString(t, NewFormatter(UseAttributeOptions(AttributeOptions{Quote: '"'})), src))
+}
+
+func TestSuppressGo(t *testing.T) {
+	formatter := NewFormatter(UseGoFmt(false))
+	src := "<script type='application/x-go'>\n" +
+		"var  a = 1\n" +
+		"// vugufmt:off\n" +
+		"var table = []int{\n" +
+		"    1,   2,\n" +
+		"    30, 40,\n" +
+		"}\n" +
+		"// vugufmt:on\n" +
+		"func f() {\n" +
+		"    // vugufmt:off\n" +
+		"    x  :=  1\n" +
+		"    // vugufmt:on\n" +
+		"  _ = x\n" +
+		"}\n" +
+		"</script>"
+	// gofmt puts a blank line before a declaration with a doc
+	// comment, which the one after vugufmt:off is.
+	assert.Equal(t,
+		"<script type='application/x-go'>\n"+
+			"var a = 1\n\n"+
+			"// vugufmt:off\n"+
+			"var table = []int{\n"+
+			"    1,   2,\n"+
+			"    30, 40,\n"+
+			"}\n"+
+			"// vugufmt:on\n"+
+			"func f() {\n"+
+			"\t// vugufmt:off\n"+
+			"    x  :=  1\n"+
+			"\t// vugufmt:on\n"+
+			"\t_ = x\n"+
+			"}\n"+
+			"</script>",
+		formatString(t, formatter, src))
+
+	// errors after a region are on the right line.
+	src = "<script type='application/x-go'>\n" +
+		"// vugufmt:off\n" +
+		"var a = 1\n" +
+		"var b = 2\n" +
+		"// vugufmt:on\n" +
+		"var c := 3\n" +
+		"</script>"
+	err := formatter.FormatHTML("", strings.NewReader(src), ioutil.Discard)
+	require.NotNil(t, err)
+	assert.Equal(t, 6, err.Line)
+}
+
+func TestMaskGo(t *testing.T) {
+	src := "a\n// vugufmt:off\nb\n\nc\n// vugufmt:on\nd\n// vugufmt:off\ne\n"
+	masked, regions := maskGo([]byte(src))
+	// every line stays where it is.
+	assert.Equal(t, "a\n// vugufmt:off\n"+
+		"// vugufmt:suppressed 0\n// vugufmt:suppressed 0\n// vugufmt:suppressed 0\n"+
+		"// vugufmt:on\nd\n// vugufmt:off\n// vugufmt:suppressed 1\n", string(masked))
+	assert.Equal(t, [][]byte{[]byte("b\n\nc\n"), []byte("e\n")}, regions)
+
+	res, ok := unmaskGo(bytes.Replace(masked, []byte("// vugufmt:suppressed"), []byte("\t// vugufmt:suppressed"), -1), regions)
+	assert.True(t, ok)
+	assert.Equal(t, src, string(res))
+
+	_, ok = unmaskGo([]byte("a\n// vugufmt:suppressed 0\n"), regions)
+	assert.False(t, ok)
+}
+
+func TestSuppressRange(t *testing.T) {
+	formatter := NewFormatter(upperFormatter)
+	src := "<div>\n" +
+		"<!-- vugufmt:ignore-next -->\n" +
+		"<script type='upper'>\none\n</script>\n" +
+		"<script type='upper'>\ntwo\n</script>\n" +
+		"</div>\n"
+	res, err := formatter.FormatRange("", []byte(src), []LineRange{{1, 9}})
+	require.Nil(t, err)
+	assert.Equal(t, "<div>\n<!-- vugufmt:ignore-next -->\n<script type='upper'>\none\n</script>\n<script type='upper'>\nTWO\n</script>\n</div>\n", string(res))
+
+	res, err = formatter.FormatRange("", []byte(src), []LineRange{{4, 4}})
+	require.Nil(t, err)
+	assert.Equal(t, src, string(res))
+}
@@ -0,0 +1,443 @@
+package vugufmt
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+	"github.com/erinpentecost/vugufmt/internal/jsfmt"
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// Verify checks that res, the formatted version of src, is safe to use.
+// Formatting res again must not change it, it must have the same
+// elements, attributes, text and comments as src apart from whitespace
+// the formatter is allowed to change, its x-go blocks must have the
+// same syntax trees as the ones in src, and the JavaScript blocks that
+// UseJSFmt formats must have the same tokens.
+func (f *Formatter) Verify(filename string, src, res []byte) (ferr *FmtError) {
+	defer recoverPanic(filename, nil, &ferr)
+	var again bytes.Buffer
+	var err error
+	if err := f.FormatHTML(filename, bytes.NewReader(res), &again); err != nil {
+		err.Msg = "formatting the result again failed: " + err.Msg
+		return err
+	}
+	if !bytes.Equal(again.Bytes(), res) {
+		return &FmtError{
+			Msg:      "formatting isn't idempotent: formatting the result again changes this line",
+			FileName: filename,
+			Line:     firstDifferentLine(res, again.Bytes()),
+		}
+	}
+
+	// the outlines are compared in UTF-8, since the encoding
+	// is allowed to change, and so is the <meta> that says what it is.
+	var enc sourceEncoding
+	if src, enc, err = decode(src); err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	target, err := f.targetEncoding(enc)
+	if err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	src = relabel(src, enc, target)
+	if res, _, err = decode(res); err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	// the result is compared with src as it was after fixing it.
+	if f.AutoFix {
+		src = fixStructure(filename, src, nil)
+	}
+	want, wantBlocks, err := f.outline(src)
+	if err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	got, gotBlocks, err := f.outline(res)
+	if err != nil {
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			return &FmtError{Msg: fmt.Sprintf("formatting removed %s", want[i].desc), FileName: filename}
+		case i >= len(want):
+			return &FmtError{Msg: fmt.Sprintf("formatting added %s", got[i].desc), FileName: filename, Line: got[i].line, Column: got[i].column}
+		case want[i].desc != got[i].desc:
+			return &FmtError{
+				Msg:      fmt.Sprintf("formatting changed %s into %s", want[i].desc, got[i].desc),
+				FileName: filename,
+				Line:     got[i].line,
+				Column:   got[i].column,
+			}
+		}
+	}
+
+	for i, want := range wantBlocks {
+		got := gotBlocks[i]
+		if want.js {
+			if err := jsChange(filename, want.src, got); err != nil {
+				return err
+			}
+			continue
+		}
+		same, err := sameGo(want.src, got.src)
+		if err != nil {
+			return goParseError(filename, got.region, err)
+		}
+		if !same {
+			err := &FmtError{Msg: "formatting changed the syntax tree of this x-go block", FileName: filename}
+			return regionError(got.region, err)
+		}
+	}
+	return nil
+}
+
+// jsChange reports where the tokens of got, a formatted JavaScript
+// block, differ from those of src.
+func jsChange(filename string, src []byte, got scriptBlock) *FmtError {
+	switch err := jsfmt.Compare(src, got.src).(type) {
+	case nil:
+		return nil
+	case *jsfmt.ChangeError:
+		ferr := &FmtError{Msg: "formatting changed the tokens of this JavaScript block", FileName: filename, Line: err.Line, Column: err.Column}
+		return regionError(got.region, ferr)
+	case *jsfmt.SyntaxError:
+		ferr := &FmtError{Msg: "formatted JavaScript block can't be read: " + err.Msg, FileName: filename, Line: err.Line, Column: err.Column}
+		return regionError(got.region, ferr)
+	default:
+		return &FmtError{Msg: err.Error(), FileName: filename}
+	}
+}
+
+// firstDifferentLine returns the first line where a and b differ.
+func firstDifferentLine(a, b []byte) int {
+	line := 1
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// outlineToken is a token of a document, described in a way
+// that doesn't depend on how it's formatted.
+type outlineToken struct {
+	desc         string
+	text         bool
+	line, column int
+}
+
+// scriptBlock is the source of an x-go block, or of a JavaScript
+// block if js is set, and where it is.
+type scriptBlock struct {
+	src    []byte
+	region srcmap.Region
+	js     bool
+}
+
+// goParseError reports err, from parsing the formatted code
+// of the x-go block at r, where it is in the file.
+func goParseError(filename string, r srcmap.Region, err error) *FmtError {
+	ferr := &FmtError{Msg: "formatted x-go block doesn't parse: " + err.Error(), FileName: filename}
+	if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+		ferr.Msg = "formatted x-go block doesn't parse: " + list[0].Msg
+		ferr.Line, ferr.Column = list[0].Pos.Line, list[0].Pos.Column
+	}
+	return regionError(r, ferr)
+}
+
+// outline describes the tokens of a document, leaving out
+// whitespace that the formatter is allowed to change.
+func (f *Formatter) outline(src []byte) ([]outlineToken, []scriptBlock, error) {
+	izer := htmlx.NewTokenizer(bytes.NewReader(src))
+	// the case of component and prop names matters.
+	izer.PreserveCase(true)
+	var toks []outlineToken
+	var blocks []scriptBlock
+	var stack []htmlx.Token
+	// lastBlock is whether the last tag allows the
+	// whitespace after it to change.
+	lastBlock := true
+	pre := 0
+	// offset is where the next token starts.
+	offset := 0
+
+	for {
+		tt := izer.Next()
+		if tt == htmlx.ErrorToken {
+			if err := izer.Err(); err != io.EOF {
+				return nil, nil, err
+			}
+			break
+		}
+		start := offset
+		offset += len(izer.RawData())
+		tok := izer.Token()
+		ot := outlineToken{line: tok.Line + 1, column: tok.Column + 1}
+
+		switch tt {
+		case htmlx.StartTagToken, htmlx.SelfClosingTagToken:
+			ot.desc = describeTag(tok)
+			block := f.isBlock(tok.DataAtom)
+			trimLastText(toks, block)
+			lastBlock = block
+			if tt == htmlx.StartTagToken {
+				stack = append(stack, tok)
+				if preformatted(tok.DataAtom) {
+					pre++
+				}
+			}
+		case htmlx.EndTagToken:
+			ot.desc = "</" + tok.Data + ">"
+			block := f.isBlock(tok.DataAtom)
+			trimLastText(toks, block)
+			lastBlock = block
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			if preformatted(tok.DataAtom) && pre > 0 {
+				pre--
+			}
+		case htmlx.TextToken:
+			var parent htmlx.Token
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			switch {
+			case parent.DataAtom == atom.Script:
+				scriptType := strings.ToLower(attr(parent, "type"))
+				sf, ok := f.scriptFormatter(scriptType)
+				if scriptType == goScriptType {
+					blocks = append(blocks, scriptBlock{src: []byte(tok.Data), region: textRegion(&tok, start, []byte(tok.Data))})
+					ot.desc = "x-go block"
+				} else if _, js := sf.(jsFmt); js {
+					blocks = append(blocks, scriptBlock{src: []byte(tok.Data), region: textRegion(&tok, start, []byte(tok.Data)), js: true})
+					ot.desc = "JavaScript block"
+				} else if ok {
+					ot.desc = scriptType + " block"
+				} else {
+					ot.desc = fmt.Sprintf("script %q", tok.Data)
+				}
+			case parent.DataAtom == atom.Style && f.StyleFormatter != nil:
+				ot.desc = "style block"
+			case parent.DataAtom == atom.Style || pre > 0:
+				ot.desc = fmt.Sprintf("text %q", tok.Data)
+			default:
+				text := collapseSpace(tok.Data)
+				if lastBlock {
+					text = strings.TrimLeft(text, " ")
+				}
+				if text == "" {
+					continue
+				}
+				ot.desc = text
+				ot.text = true
+			}
+		case htmlx.CommentToken:
+			if htmlMarker([]byte("<!--"+tok.Data+"-->")) != "" {
+				ot.desc = "<!--" + tok.Data + "-->"
+			} else {
+				ot.desc = "<!-- " + strings.Join(strings.FieldsFunc(tok.Data, isSpaceRune), " ") + " -->"
+			}
+		default:
+			ot.desc = tok.String()
+		}
+		toks = append(toks, ot)
+	}
+
+	// whitespace at the end of the document doesn't matter either.
+	trimLastText(toks, true)
+	var res []outlineToken
+	for _, t := range toks {
+		if t.text {
+			if t.desc == "" {
+				continue
+			}
+			t.desc = fmt.Sprintf("text %q", t.desc)
+		}
+		res = append(res, t)
+	}
+	return res, blocks, nil
+}
+
+// trimLastText removes the whitespace at the end of the last token
+// if it's text and it comes right before a block.
+func trimLastText(toks []outlineToken, block bool) {
+	if i := len(toks) - 1; i >= 0 && block && toks[i].text {
+		toks[i].desc = strings.TrimRight(toks[i].desc, " ")
+	}
+}
+
+// describeTag describes a tag. Attributes are sorted, since their
+// order can change, and their values are unescaped.
+func describeTag(tok htmlx.Token) string {
+	attrs := make([]string, len(tok.Attr))
+	for i, a := range tok.Attr {
+		attrs[i] = fmt.Sprintf(" %s=%q", a.Key, a.Val)
+	}
+	sort.Strings(attrs)
+	end := ">"
+	if tok.Type == htmlx.SelfClosingTagToken {
+		end = "/>"
+	}
+	return "<" + tok.Data + strings.Join(attrs, "") + end
+}
+
+// attr returns the value of an attribute of tok.
+func attr(tok htmlx.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// collapseSpace turns every run of whitespace in s into a single space.
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if isSpace(s[i]) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// sameGo reports whether two x-go blocks have the same syntax tree.
+// Imports are left out, since goimports changes them on purpose.
+func sameGo(a, b []byte) (bool, error) {
+	treeA, err := goTree(a)
+	if err != nil {
+		// if the source doesn't parse, there's nothing to compare to.
+		return true, nil
+	}
+	treeB, err := goTree(b)
+	if err != nil {
+		return false, err
+	}
+	return treeA == treeB, nil
+}
+
+// goTree parses an x-go block and prints its syntax tree, comments
+// included, without any positions. The block is simplified and printed
+// the way gofmt -s does first, since the formatter may do that too.
+func goTree(src []byte) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parseGoFragment(fset, src)
+	if err != nil {
+		return "", err
+	}
+	simplify(file)
+	var printed bytes.Buffer
+	if err := format.Node(&printed, fset, file); err != nil {
+		return "", err
+	}
+	file, err = parser.ParseFile(token.NewFileSet(), "", printed.Bytes(), parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+
+	var decls []ast.Decl
+	var imports []*ast.GenDecl
+	for _, d := range file.Decls {
+		if gen, ok := d.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			imports = append(imports, gen)
+			continue
+		}
+		decls = append(decls, d)
+	}
+	file.Decls = decls
+	var comments []*ast.CommentGroup
+	for _, c := range file.Comments {
+		if !importComment(imports, c) {
+			comments = append(comments, c)
+		}
+	}
+	file.Comments = comments
+
+	var buf bytes.Buffer
+	err = printTree(&buf, file)
+	return buf.String(), err
+}
+
+// importComment reports whether c documents or is inside
+// one of the import declarations.
+func importComment(imports []*ast.GenDecl, c *ast.CommentGroup) bool {
+	for _, gen := range imports {
+		if c == gen.Doc || (gen.Pos() <= c.Pos() && c.End() <= gen.End()) {
+			return true
+		}
+	}
+	return false
+}
+
+// printTree prints node without any positions. Comments are only
+// printed from the file's list of them, so each is printed once.
+func printTree(w io.Writer, node ast.Node) error {
+	posType := reflect.TypeOf(token.NoPos)
+	return ast.Fprint(w, nil, node, func(name string, v reflect.Value) bool {
+		switch name {
+		case "Obj", "Scope", "Unresolved", "Imports", "Doc", "Comment":
+			return false
+		}
+		return v.Type() != posType
+	})
+}
+
+// declHeader makes a list of declarations into a Go file.
+const declHeader = "package p;"
+
+// parseGoFragment parses an x-go block, which can be a whole file,
+// a list of declarations or a list of statements, like gofmt does.
+func parseGoFragment(fset *token.FileSet, src []byte) (*ast.File, error) {
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err == nil {
+		return file, nil
+	}
+	file, declErr := parser.ParseFile(fset, "", append([]byte(declHeader), src...), parser.ParseComments)
+	if declErr == nil {
+		return file, nil
+	}
+	stmts := append(append([]byte("package p; func _() {"), src...), "\n}"...)
+	if file, stmtErr := parser.ParseFile(fset, "", stmts, parser.ParseComments); stmtErr == nil {
+		return file, nil
+	}
+	// x-go blocks are usually declarations, so that's the
+	// error that is reported, where it is in src.
+	list, ok := declErr.(scanner.ErrorList)
+	if !ok {
+		return nil, err
+	}
+	r := srcmap.New(srcmap.Position{Offset: len(declHeader), Line: 1, Column: len(declHeader) + 1}, src)
+	for _, e := range list {
+		p, ok := r.FromHost(srcmap.Position{Offset: e.Pos.Offset, Line: e.Pos.Line, Column: e.Pos.Column})
+		if !ok {
+			return nil, err
+		}
+		e.Pos.Offset, e.Pos.Line, e.Pos.Column = p.Offset, p.Line, p.Column
+	}
+	return nil, list
+}
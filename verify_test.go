@@ -0,0 +1,110 @@
+package vugufmt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyFormatted(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "bad", "root.vugu"))
+	require.NoError(t, err)
+
+	formatters := []*Formatter{
+		NewFormatter(UseGoFmt(true)),
+		NewFormatter(UseGoFmt(false), UseAttributeOptions(AttributeOptions{Quote: '"', Sort: true, WrapAfter: 2})),
+		NewFormatter(UseGoFmt(false), UseMaxWidth(40), UseWhitespaceSensitivity(WhitespaceCSS)),
+		NewFormatter(UseGoFmt(false), UseMaxWidth(20), UseReflow(true)),
+	}
+	for _, f := range formatters {
+		for _, s := range append(whitespaceTests, string(src)) {
+			res := formatString(t, f, s)
+			assert.Nil(t, f.Verify("", []byte(s), []byte(res)), res)
+		}
+	}
+}
+
+func TestVerifyIdempotent(t *testing.T) {
+	f := NewFormatter(UseMaxWidth(20), UseWhitespaceSensitivity(WhitespaceCSS))
+	err := f.Verify("", []byte("<div><p>a</p></div>"), []byte("<div>\n<p>a</p></div>"))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "idempotent")
+	assert.Equal(t, 2, err.Line)
+}
+
+func TestVerifyStructure(t *testing.T) {
+	f := NewFormatter()
+	for _, c := range []struct{ src, res string }{
+		{"<div a='1'>x</div>", "<div a='2'>x</div>"},
+		{"<div>x</div>", "<div>y</div>"},
+		{"<span>a b</span>", "<span>ab</span>"},
+		{"<div><p>a</p></div>", "<div></div>"},
+		{"<pre>a  b</pre>", "<pre>a b</pre>"},
+		{"<!-- a -->", "<!-- b -->"},
+		{"<MyComp :DataSource='x'/>", "<mycomp :DataSource='x'/>"},
+		{"<MyComp :DataSource='x'/>", "<MyComp :datasource='x'/>"},
+	} {
+		assert.NotNil(t, f.Verify("", []byte(c.src), []byte(c.res)), c.res)
+	}
+
+	// attribute order and quotes, and whitespace next to blocks, don't matter.
+	css := NewFormatter(UseWhitespaceSensitivity(WhitespaceCSS))
+	assert.Nil(t, css.Verify("", []byte("<div b=\"2\" a='1'> <p>a</p></div>"), []byte("<div a=1 b='2'><p>a</p></div>")))
+	// but they do next to inline elements in strict mode.
+	assert.NotNil(t, f.Verify("", []byte("<span> <b>a</b></span>"), []byte("<span><b>a</b></span>")))
+}
+
+func TestVerifyGo(t *testing.T) {
+	f := NewFormatter(UseGoFmt(true))
+	src := "<script type=\"application/x-go\">\nvar s = []T{T{1}}\nfunc f() { for _ = range s {} }\n</script>\n"
+	res := formatString(t, f, src)
+	assert.Nil(t, f.Verify("", []byte(src), []byte(res)))
+
+	// anything that gofmt -s simplifies is the same.
+	slice := "<script type=\"application/x-go\">\nvar t = s[1:len(s)]\n</script>\n"
+	res = formatString(t, f, slice)
+	assert.Contains(t, res, "s[1:]")
+	assert.Nil(t, f.Verify("", []byte(slice), []byte(res)))
+
+	changed := "<script type=\"application/x-go\">\nvar s = []T{{2}}\n\nfunc f() {\n\tfor range s {\n\t}\n}\n</script>\n"
+	err := f.Verify("", []byte(src), []byte(changed))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "syntax tree")
+	assert.Equal(t, 1, err.Line)
+	assert.Equal(t, 33, err.Column)
+
+	// comments are part of the tree.
+	commented := "<script type=\"application/x-go\">\n// f does nothing.\nfunc f() {}\n</script>\n"
+	uncommented := "<script type=\"application/x-go\">\nfunc f() {}\n</script>\n"
+	assert.Nil(t, f.Verify("", []byte(commented), []byte(formatString(t, f, commented))))
+	assert.NotNil(t, f.Verify("", []byte(commented), []byte(uncommented)))
+
+	// parse errors are where they are in the file.
+	broken := "<script type=\"application/x-go\">var s = )\n</script>\n"
+	err = NewFormatter().Verify("", []byte(src), []byte(broken))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "doesn't parse")
+	assert.Equal(t, 1, err.Line)
+	assert.Equal(t, 41, err.Column)
+}
+
+func TestVerifyJS(t *testing.T) {
+	f := NewFormatter(UseJSFmt)
+	src := "<script>\nif (x) /re/.test('s')\n</script>\n"
+	res := formatString(t, f, src)
+	assert.Equal(t, "<script>\nif (x) /re/.test(\"s\");\n</script>\n", res)
+	assert.Nil(t, f.Verify("", []byte(src), []byte(res)))
+
+	changed := "<script>\nif (x) / re /.test(\"s\");\n</script>\n"
+	err := f.Verify("", []byte(src), []byte(changed))
+	require.NotNil(t, err)
+	assert.Contains(t, err.Msg, "tokens of this JavaScript block")
+	assert.Equal(t, 2, err.Line)
+	assert.Equal(t, 8, err.Column)
+
+	// without UseJSFmt, script blocks are compared as text.
+	assert.NotNil(t, NewFormatter().Verify("", []byte(src), []byte(res)))
+}
@@ -0,0 +1,6 @@
+package vugufmt
+
+// Version is the version of vugufmt.
+// Anything that remembers formatting results, like the
+// command line tool's cache, should take it into account.
+const Version = "0.1.0"
@@ -0,0 +1,239 @@
+// Package vuguast parses .vugu files into their template, their style
+// and script blocks, and the Go code of their x-go script block, so that
+// formatters, linters and refactorings can all work on the same model of
+// a file, rather than each looking for the parts they need.
+package vuguast
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"strings"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+	"github.com/erinpentecost/vugufmt/srcmap"
+)
+
+// GoScriptType is the type of the script block that has a component's Go code.
+const GoScriptType = "application/x-go"
+
+// goHeader is put in front of Go code that doesn't have a package
+// clause, which is how x-go script blocks are usually written.
+const goHeader = "package main; "
+
+// File is a parsed .vugu file.
+type File struct {
+	// Name is the file's name, which positions are reported with.
+	Name string
+	// Doc is the whole file. Its top-level nodes are the Template,
+	// the Styles and Scripts, and whatever is between them.
+	Doc *htmlx.Node
+	// Template is the top-level element that isn't a style or
+	// script block, or nil if there isn't one.
+	Template *htmlx.Node
+	// Styles and Scripts are the top-level style and script blocks.
+	// Ones inside of the template belong to the template.
+	Styles  []StyleBlock
+	Scripts []ScriptBlock
+	// Fset and GoFile are the Go code of the x-go script block.
+	// GoFile is nil if there isn't one. If the code doesn't have
+	// a package clause, GoFile's package is main.
+	Fset   *token.FileSet
+	GoFile *ast.File
+
+	// goBlock is the x-go script block, and goFile is its code.
+	goBlock *ScriptBlock
+	goFile  *token.File
+	// goStart is where the script block's Content starts in goFile,
+	// and goRegion is where goFile would be in the file if the
+	// goHeader in front of it were there too.
+	goStart  int
+	goRegion srcmap.Region
+}
+
+// Block is a style or script element and its contents.
+type Block struct {
+	// Node is the element.
+	Node *htmlx.Node
+	// Content is the text inside of the element. Print writes it
+	// in place of the element's contents, so changing it changes
+	// the file that Print writes.
+	Content string
+	// Region is where Content is in the file, as it was parsed.
+	Region srcmap.Region
+}
+
+// StyleBlock is a top-level <style> element.
+type StyleBlock struct {
+	Block
+}
+
+// ScriptBlock is a top-level <script> element.
+type ScriptBlock struct {
+	Block
+	// Type is the script's type attribute, like GoScriptType.
+	Type string
+}
+
+// Parse parses the .vugu file src. filename is only used for positions.
+// Errors are a scanner.ErrorList, with positions in the .vugu file.
+func Parse(filename string, src []byte) (*File, error) {
+	f := &File{Name: filename, Fset: token.NewFileSet()}
+	doc, err := htmlx.ParseTree(bytes.NewReader(src))
+	if err != nil {
+		if serr, ok := err.(*htmlx.SyntaxError); ok {
+			return nil, f.errorAt(serr.Pos, serr.Msg)
+		}
+		return nil, err
+	}
+	f.Doc = doc
+
+	for n := doc.FirstChild; n != nil; n = n.NextSibling {
+		if n.Type != htmlx.ElementNode {
+			continue
+		}
+		b := Block{Node: n}
+		if n.FirstChild != nil {
+			b.Content = string(n.FirstChild.Raw)
+		}
+		b.Region = srcmap.New(srcmap.New(n.Pos, n.Raw).End, []byte(b.Content))
+		switch {
+		case n.DataAtom == atom.Style:
+			f.Styles = append(f.Styles, StyleBlock{Block: b})
+		case n.DataAtom == atom.Script:
+			f.Scripts = append(f.Scripts, ScriptBlock{Block: b, Type: attr(n, "type")})
+		case f.Template != nil:
+			return nil, f.errorAt(n.Pos, fmt.Sprintf("more than one template element: <%s> and <%s>", f.Template.Data, n.Data))
+		default:
+			f.Template = n
+		}
+	}
+
+	for i := range f.Scripts {
+		if !strings.EqualFold(f.Scripts[i].Type, GoScriptType) {
+			continue
+		}
+		if f.goBlock != nil {
+			return nil, f.errorAt(f.Scripts[i].Node.Pos, "more than one "+GoScriptType+" script block")
+		}
+		f.goBlock = &f.Scripts[i]
+	}
+	if f.goBlock != nil {
+		if err := f.parseGo(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// parseGo parses the code of the x-go script block.
+func (f *File) parseGo() error {
+	code := f.goBlock.Content
+	if _, err := parser.ParseFile(token.NewFileSet(), "", code, parser.PackageClauseOnly); err != nil {
+		code = goHeader + code
+		f.goStart = len(goHeader)
+	}
+	f.goRegion = f.goBlock.Region
+	f.goRegion.Start.Offset -= f.goStart
+	f.goRegion.Start.Column -= f.goStart
+
+	gf, err := parser.ParseFile(f.Fset, f.Name, code, parser.ParseComments)
+	if err != nil {
+		list, ok := err.(scanner.ErrorList)
+		if !ok {
+			return err
+		}
+		for _, e := range list {
+			e.Pos = f.goHostPosition(srcmap.Position{Offset: e.Pos.Offset, Line: e.Pos.Line, Column: e.Pos.Column})
+		}
+		return list
+	}
+	f.GoFile = gf
+	f.goFile = f.Fset.File(gf.Pos())
+	return nil
+}
+
+// goHostPosition returns where p, a position in the parsed Go code,
+// is in the file. A position in goHeader is the start of the code.
+func (f *File) goHostPosition(p srcmap.Position) token.Position {
+	if p.IsValid() && p.Offset < f.goStart {
+		p = srcmap.Position{Offset: f.goStart, Line: 1, Column: f.goStart + 1}
+	}
+	return f.position(f.goRegion.ToHost(p))
+}
+
+// position turns p into a token.Position in the file.
+func (f *File) position(p srcmap.Position) token.Position {
+	return token.Position{Filename: f.Name, Offset: p.Offset, Line: p.Line, Column: p.Column}
+}
+
+func (f *File) errorAt(p srcmap.Position, msg string) scanner.ErrorList {
+	return scanner.ErrorList{&scanner.Error{Pos: f.position(p), Msg: msg}}
+}
+
+// GoPosition returns where pos, a position in GoFile, is in the
+// file. It is the zero Position if pos isn't in GoFile.
+func (f *File) GoPosition(pos token.Pos) token.Position {
+	if f.goFile == nil || !pos.IsValid() || f.Fset.File(pos) != f.goFile {
+		return token.Position{}
+	}
+	p := f.goFile.Position(pos)
+	return f.goHostPosition(srcmap.Position{Offset: p.Offset, Line: p.Line, Column: p.Column})
+}
+
+// GoPos returns the position in GoFile of p, a position in the
+// file. It is token.NoPos if p isn't in the Go code.
+func (f *File) GoPos(p token.Position) token.Pos {
+	if f.goFile == nil {
+		return token.NoPos
+	}
+	e, ok := f.goRegion.FromHost(srcmap.Position{Offset: p.Offset, Line: p.Line, Column: p.Column})
+	if !ok || e.Offset < f.goStart {
+		return token.NoPos
+	}
+	return f.goFile.Pos(e.Offset)
+}
+
+// Print writes out f, with the Content of its style and script
+// blocks in them. If nothing was changed, it is the file as it
+// was parsed.
+func Print(w io.Writer, f *File) error {
+	contents := map[*htmlx.Node]string{}
+	for _, b := range f.Styles {
+		contents[b.Node] = b.Content
+	}
+	for _, b := range f.Scripts {
+		contents[b.Node] = b.Content
+	}
+
+	var buf bytes.Buffer
+	for n := f.Doc.FirstChild; n != nil; n = n.NextSibling {
+		content, ok := contents[n]
+		if !ok {
+			if err := htmlx.RenderTree(&buf, n); err != nil {
+				return err
+			}
+			continue
+		}
+		buf.Write(n.Raw)
+		buf.WriteString(content)
+		buf.Write(n.End)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// attr returns the value of n's attribute key.
+func attr(n *htmlx.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
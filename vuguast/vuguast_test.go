@@ -0,0 +1,99 @@
+package vuguast
+
+import (
+	"bytes"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/erinpentecost/vugufmt/srcmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	src, err := ioutil.ReadFile(filepath.Join("..", "testdata", "ok", "root.vugu"))
+	require.NoError(t, err)
+	f, err := Parse("root.vugu", src)
+	require.NoError(t, err)
+
+	require.NotNil(t, f.Template)
+	assert.Equal(t, "div", f.Template.Data)
+	assert.Empty(t, f.Styles)
+	require.Len(t, f.Scripts, 1)
+	assert.Equal(t, GoScriptType, f.Scripts[0].Type)
+	assert.True(t, strings.HasPrefix(string(src[f.Scripts[0].Region.Start.Offset:]), f.Scripts[0].Content))
+
+	require.NotNil(t, f.GoFile)
+	assert.Equal(t, "main", f.GoFile.Name.Name)
+	assert.Len(t, f.GoFile.Imports, 3)
+
+	var buf bytes.Buffer
+	require.NoError(t, Print(&buf, f))
+	assert.Equal(t, string(src), buf.String())
+}
+
+func TestPositions(t *testing.T) {
+	src := "<div>\n\t<p>a</p>\n</div>\n<style>p { color: red }</style>\n<script type=\"application/x-go\">\ntype Comp struct{}\n\nfunc (c *Comp) Name() string { return \"comp\" }\n</script>\n"
+	f, err := Parse("comp.vugu", []byte(src))
+	require.NoError(t, err)
+	require.Len(t, f.Styles, 1)
+	assert.Equal(t, "p { color: red }", f.Styles[0].Content)
+
+	var name *ast.Ident
+	ast.Inspect(f.GoFile, func(n ast.Node) bool {
+		if fn, ok := n.(*ast.FuncDecl); ok {
+			name = fn.Name
+		}
+		return true
+	})
+	require.NotNil(t, name)
+
+	// Go positions map to where the code is in the .vugu file, and back.
+	pos := f.GoPosition(name.Pos())
+	assert.Equal(t, "comp.vugu:8:16", pos.String())
+	assert.Equal(t, strings.Index(src, "Name()"), pos.Offset)
+	assert.Equal(t, name.Pos(), f.GoPos(pos))
+
+	// outside of the Go code, there is no Go position.
+	assert.False(t, f.GoPos(token.Position{Offset: 0, Line: 1, Column: 1}).IsValid())
+	script := f.Scripts[0].Node.Pos
+	assert.False(t, f.GoPos(token.Position{Offset: script.Offset, Line: script.Line, Column: script.Column}).IsValid())
+
+	// nodes and blocks know where they are.
+	assert.Equal(t, srcmap.Position{Offset: 7, Line: 2, Column: 2}, f.Template.FirstChild.NextSibling.Pos)
+	assert.Equal(t, srcmap.Position{Offset: 30, Line: 4, Column: 8}, f.Styles[0].Region.Start)
+}
+
+func TestPrintChanges(t *testing.T) {
+	src := "<div></div>\n<style>\np{}\n</style>\n<script type=\"application/x-go\"></script>\n"
+	f, err := Parse("", []byte(src))
+	require.NoError(t, err)
+	assert.NotNil(t, f.GoFile)
+
+	f.Styles[0].Content = "\np {}\n"
+	f.Scripts[0].Content = "\nvar x = 1\n"
+	var buf bytes.Buffer
+	require.NoError(t, Print(&buf, f))
+	assert.Equal(t, "<div></div>\n<style>\np {}\n</style>\n<script type=\"application/x-go\">\nvar x = 1\n</script>\n", buf.String())
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct{ src, want string }{
+		{"<div>\n<p></div>", "comp.vugu:2:4: mismatched ending tag (expected </p> for the <p> opened at 2:1, found </div>)"},
+		{"<div></div>\n<span></span>", "comp.vugu:2:1: more than one template element: <div> and <span>"},
+		{"<script type='application/x-go'></script><script type='application/x-go'></script>", "comp.vugu:1:42: more than one application/x-go script block"},
+		{"<div></div>\n<script type='application/x-go'>\nvar x = \n</script>", "comp.vugu:3:10: expected operand, found 'EOF'"},
+		{"<div></div><script type='application/x-go'>var x = )</script>", "comp.vugu:1:52: expected operand, found ')'"},
+	} {
+		_, err := Parse("comp.vugu", []byte(c.src))
+		require.Error(t, err, c.src)
+		list, ok := err.(scanner.ErrorList)
+		require.True(t, ok, c.src)
+		assert.Equal(t, c.want, list[0].Error(), c.src)
+	}
+}
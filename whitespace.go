@@ -0,0 +1,68 @@
+package vugufmt
+
+import (
+	"fmt"
+
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+)
+
+// WhitespaceSensitivity says which whitespace the layout engine
+// can add or remove when it lays out a document.
+type WhitespaceSensitivity int
+
+const (
+	// WhitespaceStrict treats every element as inline, so whitespace
+	// is only ever changed from spaces to line breaks and back.
+	// This is the default, since custom components can render as
+	// anything.
+	WhitespaceStrict WhitespaceSensitivity = iota
+	// WhitespaceCSS uses the default CSS display of each element.
+	// Whitespace around block elements, and at the start and end
+	// of them, doesn't render and can be added or removed.
+	WhitespaceCSS
+	// WhitespaceIgnore treats all whitespace between elements
+	// as insignificant.
+	WhitespaceIgnore
+)
+
+var whitespaceNames = []string{"strict", "css", "ignore"}
+
+func (ws WhitespaceSensitivity) String() string {
+	if ws < 0 || int(ws) >= len(whitespaceNames) {
+		return fmt.Sprintf("WhitespaceSensitivity(%d)", int(ws))
+	}
+	return whitespaceNames[ws]
+}
+
+// ParseWhitespaceSensitivity parses "strict", "css" or "ignore".
+func ParseWhitespaceSensitivity(s string) (WhitespaceSensitivity, error) {
+	for i, name := range whitespaceNames {
+		if s == name {
+			return WhitespaceSensitivity(i), nil
+		}
+	}
+	return WhitespaceStrict, fmt.Errorf("whitespace sensitivity must be strict, css or ignore, not %q", s)
+}
+
+// UseWhitespaceSensitivity sets which whitespace
+// can be changed when a document is laid out.
+func UseWhitespaceSensitivity(ws WhitespaceSensitivity) func(*Formatter) {
+	return func(f *Formatter) {
+		f.Whitespace = ws
+	}
+}
+
+// isBlock reports whether the whitespace around an element,
+// and at the start and end of it, can be changed. With css, that's
+// the elements that the HTML spec's default style sheet displays
+// as blocks. Elements that aren't displayed at all don't count,
+// since the whitespace on either side of them still joins up.
+func (f *Formatter) isBlock(a atom.Atom) bool {
+	switch f.Whitespace {
+	case WhitespaceCSS:
+		return atom.Info(a).Display.IsBlock()
+	case WhitespaceIgnore:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package vugufmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/erinpentecost/vugufmt/htmlx"
+	"github.com/erinpentecost/vugufmt/htmlx/atom"
+	"github.com/stretchr/testify/assert"
+)
+
+// rendered approximates what a browser shows for src. Whitespace
+// collapses, block elements start new lines, and inline elements are
+// kept as markers, so that whitespace moving in or out of them shows up.
+func rendered(src string, block func(atom.Atom) bool) string {
+	const (
+		text = iota
+		space
+		inline
+		boundary
+	)
+	type part struct {
+		kind int
+		s    string
+	}
+	parts := []part{{kind: boundary}}
+	pre := 0
+
+	z := htmlx.NewTokenizer(strings.NewReader(src))
+	for {
+		tt := z.Next()
+		if tt == htmlx.ErrorToken {
+			break
+		}
+		tok := z.Token()
+		switch tt {
+		case htmlx.StartTagToken, htmlx.EndTagToken, htmlx.SelfClosingTagToken:
+			if preformatted(tok.DataAtom) && tt == htmlx.StartTagToken {
+				pre++
+			} else if preformatted(tok.DataAtom) && tt == htmlx.EndTagToken {
+				pre--
+			}
+			if block(tok.DataAtom) {
+				parts = append(parts, part{kind: boundary})
+			} else {
+				parts = append(parts, part{inline, tok.String()})
+			}
+		case htmlx.TextToken:
+			if pre > 0 {
+				parts = append(parts, part{text, tok.Data})
+				continue
+			}
+			for i, word := range strings.Fields(" " + tok.Data + " ") {
+				if i > 0 || isSpace(tok.Data[0]) {
+					parts = append(parts, part{kind: space})
+				}
+				parts = append(parts, part{text, word})
+			}
+			if tok.Data != "" && isSpace(tok.Data[len(tok.Data)-1]) {
+				parts = append(parts, part{kind: space})
+			}
+		}
+	}
+	parts = append(parts, part{kind: boundary})
+
+	// Spaces collapse into the one before them, even across inline
+	// elements, and disappear next to block boundaries.
+	var res []string
+	for i, p := range parts {
+		switch p.kind {
+		case text, inline:
+			res = append(res, p.s)
+		case boundary:
+			res = append(res, "\n")
+		case space:
+			keep := true
+			for j := i - 1; j >= 0 && parts[j].kind != text; j-- {
+				if parts[j].kind != inline {
+					keep = false
+					break
+				}
+			}
+			for j := i + 1; j < len(parts) && keep && parts[j].kind != text; j++ {
+				if parts[j].kind == boundary {
+					keep = false
+				}
+			}
+			if keep {
+				res = append(res, " ")
+			}
+		}
+	}
+	return strings.Join(res, "")
+}
+
+func allInline(atom.Atom) bool { return false }
+
+func cssBlocks(a atom.Atom) bool { return atom.Info(a).Display.IsBlock() }
+
+var whitespaceTests = []string{
+	"<div class='demo-comp'><div vg-if='data.isLoading'>Loading...</div><div>Updated: <span vg-html='data.bpi.Time.Updated'></span></div></div>",
+	"<ul>\n<li vg-for='data.bpi.BPI'>\n<span vg-html='key'></span> <span vg-html='fmt.Sprint(value.Symbol, value.RateFloat)'></span>\n</li>\n</ul>",
+	"<p>Some <b>bold</b>text and<i> italic </i> text.</p><p>Another paragraph.</p>",
+	"<div> <p>a</p> b <span>c</span><div>d</div>e</div>",
+	"<section><h1>Title</h1><pre>  keep\n   this  </pre><my-comp :a='b'></my-comp><MyComp/></section>",
+	"<table><tr><td>one</td><td>two</td></tr><tr><td>three</td><td> four </td></tr></table>",
+}
+
+func TestWhitespacePreserved(t *testing.T) {
+	for _, src := range whitespaceTests {
+		for _, width := range []int{10, 20, 40, 80} {
+			strict := formatString(t, NewFormatter(UseMaxWidth(width)), src)
+			assert.Equal(t, rendered(src, allInline), rendered(strict, allInline), "strict, width %d:\n%s", width, strict)
+			assert.Equal(t, rendered(src, cssBlocks), rendered(strict, cssBlocks), "strict, width %d:\n%s", width, strict)
+
+			css := formatString(t, NewFormatter(UseMaxWidth(width), UseWhitespaceSensitivity(WhitespaceCSS)), src)
+			assert.Equal(t, rendered(src, cssBlocks), rendered(css, cssBlocks), "css, width %d:\n%s", width, css)
+
+			reflowed := formatString(t, NewFormatter(UseMaxWidth(width), UseReflow(true)), src)
+			assert.Equal(t, rendered(src, allInline), rendered(reflowed, allInline), "reflow, width %d:\n%s", width, reflowed)
+		}
+	}
+}
+
+func TestWhitespaceModes(t *testing.T) {
+	src := "<div><p>Some text</p><p>more</p></div>"
+
+	strict := NewFormatter(UseMaxWidth(20))
+	assert.Equal(t, src, formatString(t, strict, src))
+
+	css := NewFormatter(UseMaxWidth(20), UseWhitespaceSensitivity(WhitespaceCSS))
+	assert.Equal(t, "<div>\n    <p>Some text</p>\n    <p>more</p>\n</div>", formatString(t, css, src))
+	// whitespace at the start and end of a block goes away if it fits.
+	assert.Equal(t, "<div><p>a</p></div>", formatString(t, css, "<div> <p> a </p> </div>"))
+	// but not around inline elements.
+	css.MaxWidth = 40
+	assert.Equal(t, "<span> <b>a</b> </span>", formatString(t, css, "<span> <b>a</b> </span>"))
+
+	ignore := NewFormatter(UseMaxWidth(14), UseWhitespaceSensitivity(WhitespaceIgnore))
+	assert.Equal(t, "<span>\n    <b>a</b>\n    <i>b</i>\n</span>", formatString(t, ignore, "<span><b>a</b><i>b</i></span>"))
+}
+
+func TestParseWhitespaceSensitivity(t *testing.T) {
+	for _, ws := range []WhitespaceSensitivity{WhitespaceStrict, WhitespaceCSS, WhitespaceIgnore} {
+		parsed, err := ParseWhitespaceSensitivity(ws.String())
+		assert.NoError(t, err)
+		assert.Equal(t, ws, parsed)
+	}
+	_, err := ParseWhitespaceSensitivity("loose")
+	assert.Error(t, err)
+}